@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/pprof"
+	"github.com/gofiber/fiber/v3/middleware/recover"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/config"
+)
+
+// adminApp returns the app of the admin listener, serving metrics, pprof, the
+// catalog admin and the configuration. Its middleware is its own: requests are
+// logged, audited and, with an authenticator, restricted to admins, but neither
+// rate limited nor counted in the request metrics.
+func adminApp(cfg config.Config, authenticator *auth.Authenticator) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: customErrorHandler,
+	})
+
+	app.Use(requestid.New())
+	app.Use(accessLogMiddleware())
+	app.Use(auditMiddleware(api.AuditLog))
+	app.Use(errorMiddleware(), recover.New())
+	app.Use(adminAuthMiddleware(authenticator))
+	app.Use(pprof.New())
+
+	setupAdminRoutes(app, cfg)
+	return app
+}
+
+func setupAdminRoutes(app *fiber.App, cfg config.Config) {
+	app.Get("/metrics", api.GetMetrics)
+	app.Get("/catalog", api.GetProducts)
+	app.Put("/catalog", api.ReplaceCatalog)
+	app.Put("/catalog/products/:product_id", api.PutCatalogProduct)
+	app.Delete("/catalog/products/:product_id", api.DeleteCatalogProduct)
+	app.Get("/config", func(c fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "application/toml; charset=utf-8")
+		return cfg.Print(c)
+	})
+}
+
+// adminAuthMiddleware admits only admins, if there is an authenticator.
+func adminAuthMiddleware(authenticator *auth.Authenticator) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if authenticator == nil {
+			return c.Next()
+		}
+
+		p, err := authenticator.Authenticate(c)
+		if err != nil {
+			return auth.Error(c, fiber.StatusUnauthorized)
+		}
+		auth.SetPrincipal(c, p)
+		if p.Role != auth.RoleAdmin {
+			return auth.Error(c, fiber.StatusForbidden)
+		}
+		return c.Next()
+	}
+}
+
+// setupAdminAuth returns the authenticator of the admin API keys, or the API
+// authenticator if there are none.
+func setupAdminAuth(cfg config.Admin, authenticator *auth.Authenticator) (*auth.Authenticator, error) {
+	if cfg.APIKeys == "" {
+		return authenticator, nil
+	}
+	keys, err := auth.LoadKeys(cfg.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewAuthenticator(keys)
+}
+
+// listenAdmin returns the listener of the admin address: a TCP address, served
+// with TLS like the API if a certificate is configured, or "unix:<path>" for a
+// Unix socket only its owner may connect to.
+func listenAdmin(addr string, tlsCfg config.TLS) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return listen(addr, tlsCfg)
+	}
+
+	// A socket left behind by a process that did not shut down blocks the address.
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
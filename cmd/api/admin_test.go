@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/certs/certstest"
+	"awesomeProject/pkg/config"
+	"awesomeProject/pkg/data"
+)
+
+func setupAdminApp(t *testing.T, cfg config.Config) *fiber.App {
+	t.Helper()
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{Name: "web", Role: auth.RoleCustomer, Hash: auth.HashKey(customerKey)},
+		{Name: "ops", Role: auth.RoleAdmin, Hash: auth.HashKey(adminKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adminApp(cfg, authenticator)
+}
+
+// Test that the admin listener only admits admins and serves the configuration with secrets redacted.
+func TestAdminApp(t *testing.T) {
+	t.Parallel()
+	cfg := config.Default()
+	cfg.Auth.JWT.HMACSecret = jwtSecret
+	app := setupAdminApp(t, cfg)
+
+	authRequest(t, app, fiber.MethodGet, "/config", "", "", http.StatusUnauthorized)
+	authRequest(t, app, fiber.MethodGet, "/config", customerKey, "", http.StatusForbidden)
+
+	resp := authRequest(t, app, fiber.MethodGet, "/config", adminKey, "", http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), jwtSecret) || !strings.Contains(string(body), `jwt_secret = "REDACTED"`) {
+		t.Errorf("configuration dump does not redact the JWT secret:\n%s", body)
+	}
+
+	authRequest(t, app, fiber.MethodGet, "/debug/pprof/", adminKey, "", http.StatusOK)
+	authRequest(t, app, fiber.MethodGet, "/metrics", adminKey, "", http.StatusOK)
+
+	// Operational routes are not served on the public app.
+	public := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	setupRoutes(public)
+	for _, path := range []string{"/metrics", "/catalog", "/config", "/debug/pprof/"} {
+		performRequestAndCheckStatus(t, public, fiber.MethodGet, path, nil, http.StatusNotFound).Body.Close()
+	}
+}
+
+// Test that the admin listener falls back to the admins of the API authentication without admin keys.
+func TestAdminAuthFallback(t *testing.T) {
+	t.Parallel()
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{Name: "web", Role: auth.RoleCustomer, Hash: auth.HashKey(customerKey)},
+		{Name: "ops", Role: auth.RoleAdmin, Hash: auth.HashKey(adminKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminAuth, err := setupAdminAuth(config.Admin{}, authenticator)
+	if err != nil || adminAuth != authenticator {
+		t.Fatalf("admin authenticator without admin keys: %v, %v", adminAuth, err)
+	}
+	app := adminApp(config.Default(), adminAuth)
+	authRequest(t, app, fiber.MethodPut, "/catalog", "", "[]", http.StatusUnauthorized)
+	authRequest(t, app, fiber.MethodPut, "/catalog", customerKey, "[]", http.StatusForbidden)
+	authRequest(t, app, fiber.MethodGet, "/config", adminKey, "", http.StatusOK)
+
+	// Admin keys replace the API keys on the admin listener.
+	keys := filepath.Join(t.TempDir(), "admin-keys.json")
+	if err := os.WriteFile(keys, []byte(`[{"name": "root", "role": "admin", "hash": "`+auth.HashKey("root-key")+`"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if adminAuth, err = setupAdminAuth(config.Admin{APIKeys: keys}, authenticator); err != nil {
+		t.Fatal(err)
+	}
+	app = adminApp(config.Default(), adminAuth)
+	authRequest(t, app, fiber.MethodGet, "/config", adminKey, "", http.StatusUnauthorized)
+	authRequest(t, app, fiber.MethodGet, "/config", "root-key", "", http.StatusOK)
+}
+
+// Test changing the catalog on the admin app while the API serves it.
+// It changes the global catalog, so it does not run in parallel and restores the catalog.
+func TestCatalogAdmin(t *testing.T) {
+	catalog := data.Products()
+	t.Cleanup(func() { _ = data.SetProducts(catalog) })
+	admin := setupAdminApp(t, config.Default())
+	app := fiber.New()
+	registerHandlers(app)
+
+	authRequest(t, admin, fiber.MethodPut, "/catalog/products/1000", adminKey, `{"name": "Mustard", "price": "0.89"}`, http.StatusCreated)
+	authRequest(t, admin, fiber.MethodPut, "/catalog/products/1000", adminKey, `{"name": "Mustard", "price": "0.79"}`, http.StatusOK)
+	authRequest(t, admin, fiber.MethodPut, "/catalog/products/1000", adminKey, `{"name": "Mustard", "price": "cheap"}`, http.StatusBadRequest)
+	for _, price := range []string{"NaN", "Inf", "1e308", "-0.79", "0.7", "0.799", "1000000000.00"} {
+		authRequest(t, admin, fiber.MethodPut, "/catalog/products/1000", adminKey, `{"name": "Mustard", "price": "`+price+`"}`, http.StatusBadRequest)
+	}
+	authRequest(t, admin, fiber.MethodPut, "/catalog/products/1000", adminKey, `{"id": 1001, "name": "Mustard", "price": "0.79"}`, http.StatusBadRequest)
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "1000", false)
+	if got := getOrder(t, app, order.ID); got.Products[0].Name != "Mustard" || got.Amount.Total != "0.79" {
+		t.Errorf("unexpected order of the new product: %+v", got)
+	}
+
+	// Deleted products can no longer be added; lines already in orders stay.
+	authRequest(t, admin, fiber.MethodDelete, "/catalog/products/1000", adminKey, "", http.StatusOK)
+	authRequest(t, admin, fiber.MethodDelete, "/catalog/products/1000", adminKey, "", http.StatusNotFound)
+	if _, ok := data.FindProduct(1000); ok {
+		t.Error("deleted product still in the catalog")
+	}
+	if got := getOrder(t, app, order.ID); len(got.Products) != 1 || got.Amount.Total != "0.79" {
+		t.Errorf("order changed by deleting the product: %+v", got)
+	}
+
+	authRequest(t, admin, fiber.MethodPut, "/catalog", adminKey, `[{"id": 1, "name": "Salt", "price": "0.30"}, {"id": 1, "name": "Pepper", "price": "1.20"}]`, http.StatusBadRequest)
+	authRequest(t, admin, fiber.MethodPut, "/catalog", adminKey, `[]`, http.StatusBadRequest)
+	authRequest(t, admin, fiber.MethodPut, "/catalog", adminKey, `[{"id": 1, "name": "Salt", "price": "0.30"}]`, http.StatusOK)
+	if products := data.Products(); len(products) != 1 || products[0].Name != "Salt" {
+		t.Errorf("catalog not replaced: %+v", products)
+	}
+}
+
+// Test serving the admin app on a Unix socket, replacing a socket left behind.
+func TestAdminUnixSocket(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenAdmin("unix:"+path, config.TLS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := adminApp(config.Default(), nil)
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		}},
+		Timeout: 5 * time.Second,
+	}
+	resp, err := client.Get("http://admin/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkStatusCode(t, resp, http.StatusOK)
+}
+
+// Test that a TCP admin listener is served with the TLS settings of the API.
+func TestAdminTLS(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca := certstest.Issue(t, "test CA", nil)
+	certPEM, keyPEM := certstest.Issue(t, "localhost", ca).PEM(t)
+	tlsCfg := config.TLS{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+	for path, content := range map[string][]byte{tlsCfg.CertFile: certPEM, tlsCfg.KeyFile: keyPEM} {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ln, err := listenAdmin("127.0.0.1:0", tlsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := adminApp(config.Default(), nil)
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	resp, err := tlsClient(t, ca, nil).Get("https://" + ln.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkStatusCode(t, resp, http.StatusOK)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if resp, err := client.Get("http://" + ln.Addr().String() + "/metrics"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("admin listener answered plain HTTP")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/audit"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// Test that state-changing requests are audited and can be queried per order.
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+	app.Use(requestid.New(), auditMiddleware(api.AuditLog))
+	registerHandlers(app)
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, apiOrdersPath+"/"+order.ID, nil, http.StatusOK).Body.Close()
+
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodGet, "/api/audit?order_id="+order.ID, nil, http.StatusOK)
+	var entries []audit.Entry
+	unmarshalResponseBody(t, resp, &entries)
+	resp.Body.Close()
+
+	if len(entries) != 3 {
+		t.Fatalf("got %d audit entries, want 3: %+v", len(entries), entries)
+	}
+	created, paid := entries[0], entries[2]
+	if created.Route != apiOrdersPath || created.Status != http.StatusCreated || created.RequestID == "" || created.Actor == "" {
+		t.Errorf("unexpected entry of the order creation: %+v", created)
+	}
+	if change := paid.Changes["status"]; change.Before != "NEW" || change.After != "PAID" || paid.Route != apiOrdersPath+"/:order_id" {
+		t.Errorf("unexpected entry of the status change: %+v", paid)
+	}
+
+	// Pages continue after the last sequence number of the previous one.
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, "/api/audit?limit=2&order_id="+order.ID, nil, http.StatusOK)
+	var page []audit.Entry
+	unmarshalResponseBody(t, resp, &page)
+	resp.Body.Close()
+	if len(page) != 2 || page[1].Seq != entries[1].Seq {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, fmt.Sprintf("/api/audit?limit=2&after=%d&order_id=%s", page[1].Seq, order.ID), nil, http.StatusOK)
+	unmarshalResponseBody(t, resp, &page)
+	resp.Body.Close()
+	if len(page) != 1 || page[0].Seq != paid.Seq {
+		t.Errorf("unexpected second page: %+v", page)
+	}
+
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, "/api/audit/verify", nil, http.StatusOK)
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+	unmarshalResponseBody(t, resp, &result)
+	resp.Body.Close()
+	if !result.Valid {
+		t.Error("audit log does not verify")
+	}
+
+	for _, query := range []string{"from=today", "limit=0", "limit=1001", "after=-1"} {
+		performRequestAndCheckStatus(t, app, fiber.MethodGet, "/api/audit?"+query, nil, http.StatusBadRequest).Body.Close()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	customerKey = "customer-secret"
+	cashierKey  = "cashier-secret"
+	adminKey    = "admin-secret"
+	jwtSecret   = "jwt-secret"
+)
+
+func setupAuthApp(t *testing.T) *fiber.App {
+	t.Helper()
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{Name: "web", Role: auth.RoleCustomer, Hash: auth.HashKey(customerKey)},
+		{Name: "till-1", Role: auth.RoleCashier, Hash: auth.HashKey(cashierKey)},
+		{Name: "ops", Role: auth.RoleAdmin, Hash: auth.HashKey(adminKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticator.ConfigureJWT(auth.JWTConfig{HMACSecret: jwtSecret}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(authMiddleware(authenticator, publicRoutes, routeRoles), ownershipMiddleware())
+	registerHandlers(app)
+	return app
+}
+
+// Test API key authentication and the role checks of routes and order status changes.
+func TestAPIKeyAuth(t *testing.T) {
+	t.Parallel()
+	app := setupAuthApp(t)
+
+	authRequest(t, app, fiber.MethodGet, apiProductsPath, "", "", http.StatusOK)
+	resp := authRequest(t, app, fiber.MethodPost, apiOrdersPath, "", "", http.StatusUnauthorized)
+	var body struct {
+		Errors struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Errors.Detail != "Unauthorized" {
+		t.Errorf("unexpected 401 body: %+v, %v", body, err)
+	}
+	authRequest(t, app, fiber.MethodPost, apiOrdersPath, "wrong", "", http.StatusUnauthorized)
+
+	resp = authRequest(t, app, fiber.MethodPost, apiOrdersPath, customerKey, "", http.StatusCreated)
+	var order data.Order
+	unmarshalResponseBody(t, resp, &order)
+	authRequest(t, app, fiber.MethodPost, apiOrdersPath+"/"+order.ID+"/products", customerKey, "[123]", http.StatusCreated)
+
+	orderPath := apiOrdersPath + "/" + order.ID
+	authRequest(t, app, fiber.MethodPatch, orderPath, customerKey, `{"status": "PAID"}`, http.StatusForbidden)
+	authRequest(t, app, fiber.MethodPost, orderPath+"/payments", customerKey, `{"amount": "1", "method": "cash"}`, http.StatusForbidden)
+	authRequest(t, app, fiber.MethodGet, "/api/audit", cashierKey, "", http.StatusForbidden)
+	authRequest(t, app, fiber.MethodGet, "/api/audit", adminKey, "", http.StatusOK)
+
+	authRequest(t, app, fiber.MethodPatch, orderPath, cashierKey, `{"status": "PAID"}`, http.StatusOK)
+}
+
+// Test that only cashiers and admins replace lines of PAID orders, as replacements refund money.
+func TestPaidOrderReplacementRoles(t *testing.T) {
+	t.Parallel()
+	app := setupAuthApp(t)
+
+	resp := authRequest(t, app, fiber.MethodPost, apiOrdersPath, customerKey, "", http.StatusCreated)
+	var order data.Order
+	unmarshalResponseBody(t, resp, &order)
+	orderPath := apiOrdersPath + "/" + order.ID
+	authRequest(t, app, fiber.MethodPost, orderPath+"/products", customerKey, "[999]", http.StatusCreated)
+	resp = authRequest(t, app, fiber.MethodGet, orderPath, customerKey, "", http.StatusOK)
+	unmarshalResponseBody(t, resp, &order)
+	linePath := orderPath + "/products/" + order.Products[0].ID
+
+	// Customers may still replace lines of their unpaid orders.
+	authRequest(t, app, fiber.MethodPatch, linePath, customerKey, `{"replaced_with": {"product_id": 456, "quantity": 1}}`, http.StatusOK)
+	authRequest(t, app, fiber.MethodPatch, orderPath, cashierKey, `{"status": "PAID"}`, http.StatusOK)
+
+	cheaper := `{"replaced_with": {"product_id": 123, "quantity": 1}}`
+	authRequest(t, app, fiber.MethodPatch, linePath, customerKey, cheaper, http.StatusForbidden)
+	for _, contentType := range []string{api.MIMEMergePatch, api.MIMEJSONPatch} {
+		body := cheaper
+		if contentType == api.MIMEJSONPatch {
+			body = `[{"op": "replace", "path": "/replaced_with", "value": {"product_id": 123, "quantity": 1}}]`
+		}
+		sendRequest(t, app, fiber.MethodPatch, linePath, map[string]string{
+			fiber.HeaderContentType: contentType,
+			auth.HeaderAPIKey:       customerKey,
+		}, body, http.StatusForbidden)
+	}
+	authRequest(t, app, fiber.MethodDelete, linePath+"/replaced_with", customerKey, "", http.StatusForbidden)
+
+	resp = authRequest(t, app, fiber.MethodGet, orderPath+"/refunds", customerKey, "", http.StatusOK)
+	var refunds []data.Refund
+	unmarshalResponseBody(t, resp, &refunds)
+	if len(refunds) != 0 {
+		t.Fatalf("customer changes created refunds: %+v", refunds)
+	}
+
+	authRequest(t, app, fiber.MethodPatch, linePath, cashierKey, cheaper, http.StatusOK)
+	// Admins pass the role check; the refund issued above then blocks the undo.
+	authRequest(t, app, fiber.MethodDelete, linePath+"/replaced_with", adminKey, "", http.StatusConflict)
+}
+
+// Test that customers with bearer tokens only reach their own orders.
+func TestOrderOwnership(t *testing.T) {
+	t.Parallel()
+	app := setupAuthApp(t)
+	alice, bob := bearerToken(t, "alice"), bearerToken(t, "bob")
+
+	resp := authRequest(t, app, fiber.MethodPost, apiOrdersPath, alice, "", http.StatusCreated)
+	var order data.Order
+	unmarshalResponseBody(t, resp, &order)
+	if order.Owner != "jwt:alice" {
+		t.Errorf("order owner: got %q, want jwt:alice", order.Owner)
+	}
+
+	orderPath := apiOrdersPath + "/" + order.ID
+	authRequest(t, app, fiber.MethodGet, orderPath, alice, "", http.StatusOK)
+	authRequest(t, app, fiber.MethodGet, orderPath, bob, "", http.StatusNotFound)
+	authRequest(t, app, fiber.MethodPost, orderPath+"/products", bob, "[123]", http.StatusNotFound)
+	authRequest(t, app, fiber.MethodGet, orderPath+"/history", bob, "", http.StatusNotFound)
+	authRequest(t, app, fiber.MethodGet, orderPath, cashierKey, "", http.StatusOK)
+	authRequest(t, app, fiber.MethodGet, orderPath, adminKey, "", http.StatusOK)
+	authRequest(t, app, fiber.MethodGet, orderPath, "Bearer not-a-token", "", http.StatusUnauthorized)
+}
+
+// Test that equal subjects of different authentication methods do not share orders.
+func TestOrderOwnershipAcrossMethods(t *testing.T) {
+	t.Parallel()
+	app := setupAuthApp(t)
+	token := bearerToken(t, "web") // the subject of a JWT named like the customer API key
+
+	resp := authRequest(t, app, fiber.MethodPost, apiOrdersPath, customerKey, "", http.StatusCreated)
+	var keyOrder data.Order
+	unmarshalResponseBody(t, resp, &keyOrder)
+	resp = authRequest(t, app, fiber.MethodPost, apiOrdersPath, token, "", http.StatusCreated)
+	var tokenOrder data.Order
+	unmarshalResponseBody(t, resp, &tokenOrder)
+
+	if keyOrder.Owner != "api_key:web" || tokenOrder.Owner != "jwt:web" {
+		t.Errorf("order owners: got %q and %q", keyOrder.Owner, tokenOrder.Owner)
+	}
+	authRequest(t, app, fiber.MethodGet, apiOrdersPath+"/"+keyOrder.ID, token, "", http.StatusNotFound)
+	authRequest(t, app, fiber.MethodGet, apiOrdersPath+"/"+tokenOrder.ID, customerKey, "", http.StatusNotFound)
+	authRequest(t, app, fiber.MethodGet, apiOrdersPath+"/"+keyOrder.ID, customerKey, "", http.StatusOK)
+	authRequest(t, app, fiber.MethodGet, apiOrdersPath+"/"+tokenOrder.ID, token, "", http.StatusOK)
+}
+
+// bearerToken returns the Authorization header value of an HS256 customer token.
+func bearerToken(t *testing.T, subject string) string {
+	t.Helper()
+	segment := func(v any) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signed := segment(map[string]string{"alg": auth.AlgHS256}) + "." +
+		segment(map[string]any{"sub": subject, "exp": time.Now().Add(time.Hour).Unix()})
+	mac := hmac.New(sha256.New, []byte(jwtSecret))
+	mac.Write([]byte(signed))
+	return "Bearer " + signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authRequest performs a request with a bearer token ("Bearer ...") or an API key as credentials.
+func authRequest(t *testing.T, app *fiber.App, method, path, credentials, body string, expectedStatus int) *http.Response {
+	t.Helper()
+	headers := map[string]string{fiber.HeaderContentType: fiber.MIMEApplicationJSON}
+	if strings.HasPrefix(credentials, "Bearer ") {
+		headers[fiber.HeaderAuthorization] = credentials
+	} else if credentials != "" {
+		headers[auth.HeaderAPIKey] = credentials
+	}
+	return sendRequest(t, app, method, path, headers, body, expectedStatus)
+}
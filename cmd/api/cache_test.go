@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/config"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test conditional requests for the catalog and the cache policies of the routes.
+// It changes the global catalog, so it does not run in parallel and restores the catalog.
+func TestCatalogCaching(t *testing.T) {
+	catalog := data.Products()
+	t.Cleanup(func() { _ = data.SetProducts(catalog) })
+	app := setupServerApp(t, config.Default().CORS)
+
+	// A catalog file was last modified when the file was, on every instance.
+	raw, _ := json.Marshal(catalog)
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	modified := time.Date(2024, 2, 23, 8, 12, 0, 0, time.UTC)
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.LoadProducts(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := sendRequest(t, app, fiber.MethodGet, apiProductsPath, nil, "", http.StatusOK)
+	etag, lastModified := resp.Header.Get(fiber.HeaderETag), resp.Header.Get(fiber.HeaderLastModified)
+	if len(etag) < 3 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		t.Fatalf("ETag: got %q, want a strong entity tag", etag)
+	}
+	if want := modified.Format(http.TimeFormat); lastModified != want {
+		t.Fatalf("Last-Modified: got %q, want %q", lastModified, want)
+	}
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != "public, max-age=60" {
+		t.Errorf("Cache-Control of the catalog: got %q", got)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"matching entity tag", map[string]string{fiber.HeaderIfNoneMatch: etag}, http.StatusNotModified},
+		{"one of the entity tags", map[string]string{fiber.HeaderIfNoneMatch: `"stale", ` + etag}, http.StatusNotModified},
+		{"weak entity tag", map[string]string{fiber.HeaderIfNoneMatch: "W/" + etag}, http.StatusNotModified},
+		{"any entity tag", map[string]string{fiber.HeaderIfNoneMatch: "*"}, http.StatusNotModified},
+		{"other entity tag", map[string]string{fiber.HeaderIfNoneMatch: `"stale"`}, http.StatusOK},
+		{"not modified since", map[string]string{fiber.HeaderIfModifiedSince: lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{fiber.HeaderIfModifiedSince: modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+		{"invalid date", map[string]string{fiber.HeaderIfModifiedSince: "yesterday"}, http.StatusOK},
+		// If-None-Match takes precedence over If-Modified-Since.
+		{"other entity tag not modified since", map[string]string{fiber.HeaderIfNoneMatch: `"stale"`, fiber.HeaderIfModifiedSince: lastModified}, http.StatusOK},
+	} {
+		resp := sendRequest(t, app, fiber.MethodGet, apiProductsPath, tc.headers, "", tc.status)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if tc.status == http.StatusNotModified && len(body) != 0 {
+			t.Errorf("%s: 304 with body %q", tc.name, body)
+		}
+		if got := resp.Header.Get(fiber.HeaderETag); got != etag {
+			t.Errorf("%s: ETag %q, want %q", tc.name, got, etag)
+		}
+	}
+
+	// Changing the catalog changes its entity tag.
+	if _, err := data.PutProduct(data.Product{ID: 1000, Name: "Mustard", Price: "0.89"}); err != nil {
+		t.Fatal(err)
+	}
+	resp = sendRequest(t, app, fiber.MethodGet, apiProductsPath, map[string]string{fiber.HeaderIfNoneMatch: etag}, "", http.StatusOK)
+	if got := resp.Header.Get(fiber.HeaderETag); got == etag || got == "" {
+		t.Errorf("ETag after a catalog change: got %q, was %q", got, etag)
+	}
+	changed := resp.Header.Get(fiber.HeaderETag)
+	data.DeleteProduct(1000)
+	if got := sendRequest(t, app, fiber.MethodGet, apiProductsPath, nil, "", http.StatusOK).Header.Get(fiber.HeaderETag); got != etag || got == changed {
+		t.Errorf("ETag of the restored catalog: got %q, want %q", got, etag)
+	}
+
+	// Errors, orders, probes and admin data are not stored by shared caches.
+	for _, tc := range []struct {
+		method  string
+		path    string
+		headers map[string]string
+		status  int
+		want    string
+	}{
+		{fiber.MethodPost, apiProductsPath, map[string]string{auth.HeaderAPIKey: customerKey}, http.StatusNotFound, defaultCachePolicy},
+		{fiber.MethodGet, apiOrdersPath + "/missing", map[string]string{auth.HeaderAPIKey: customerKey}, http.StatusNotFound, defaultCachePolicy},
+		{fiber.MethodGet, "/healthz", nil, http.StatusOK, "no-store"},
+		{fiber.MethodGet, "/api/audit", map[string]string{auth.HeaderAPIKey: customerKey}, http.StatusForbidden, "no-store"},
+	} {
+		resp := sendRequest(t, app, tc.method, tc.path, tc.headers, "", tc.status)
+		resp.Body.Close()
+		if got := resp.Header.Get(fiber.HeaderCacheControl); got != tc.want {
+			t.Errorf("Cache-Control of %s: got %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
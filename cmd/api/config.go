@@ -2,20 +2,33 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+
+	"awesomeProject/pkg/config"
 )
 
-// Ports can be specified with environment variables or command line flags. DEFAULT PORT 3000
-func getPort() string {
-	var port string
-	if os.Getenv("PORT") != "" {
-		port = ":" + os.Getenv("PORT")
-	} else {
-		port = ":3000"
+// getConfig loads the configuration from the defaults, the configuration file,
+// the environment and the command line flags, and exits if it is invalid.
+// With --print-config it prints the configuration, secrets redacted, and exits.
+func getConfig() config.Config {
+	printConfig := flag.Bool("print-config", false, "Print the configuration with secrets redacted and exit")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
 	}
 
-	flag.StringVar(&port, "port", port, "Port to listen on")
-	flag.Parse()
-
-	return port
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	return cfg
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/config"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const shopOrigin = "https://shop.example.com"
+
+// Test preflight and actual cross-origin requests through the whole middleware chain.
+func TestCORS(t *testing.T) {
+	t.Parallel()
+	cors := config.Default().CORS
+	cors.AllowOrigins = []string{shopOrigin}
+	cors.AllowCredentials = true
+	app := setupServerApp(t, cors)
+
+	// Preflights need no credentials and get the methods of the path, not 404.
+	resp := sendRequest(t, app, fiber.MethodOptions, "/api/orders/some-order", map[string]string{
+		fiber.HeaderOrigin:                      shopOrigin,
+		fiber.HeaderAccessControlRequestMethod:  fiber.MethodPatch,
+		fiber.HeaderAccessControlRequestHeaders: "x-api-key, content-type",
+	}, "", http.StatusNoContent)
+	for header, want := range map[string]string{
+		fiber.HeaderAccessControlAllowOrigin:      shopOrigin,
+		fiber.HeaderAccessControlAllowMethods:     "GET, PATCH",
+		fiber.HeaderAccessControlAllowHeaders:     "Authorization, Content-Type, X-API-Key, Last-Event-ID, traceparent",
+		fiber.HeaderAccessControlAllowCredentials: "true",
+		fiber.HeaderAccessControlMaxAge:           "600",
+	} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("preflight %s: got %q, want %q", header, got, want)
+		}
+	}
+	if vary := resp.Header.Get(fiber.HeaderVary); !strings.Contains(vary, fiber.HeaderOrigin) || !strings.Contains(vary, fiber.HeaderAccessControlRequestMethod) {
+		t.Errorf("preflight Vary: got %q", vary)
+	}
+
+	// Other origins get no CORS headers, so browsers block them.
+	resp = sendRequest(t, app, fiber.MethodOptions, "/api/orders", map[string]string{
+		fiber.HeaderOrigin:                     "https://evil.example.com",
+		fiber.HeaderAccessControlRequestMethod: fiber.MethodPost,
+	}, "", http.StatusUnauthorized)
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "" {
+		t.Errorf("other origin allowed: %q", got)
+	}
+
+	// OPTIONS requests that are not preflights are still rejected.
+	sendRequest(t, app, fiber.MethodOptions, "/api/orders", map[string]string{fiber.HeaderOrigin: shopOrigin}, "", http.StatusUnauthorized)
+	sendRequest(t, app, fiber.MethodOptions, "/api/orders", map[string]string{fiber.HeaderOrigin: shopOrigin, auth.HeaderAPIKey: customerKey}, "", http.StatusNotFound)
+
+	// Actual requests, errors included, can be read by the browser.
+	resp = sendRequest(t, app, fiber.MethodGet, apiProductsPath, map[string]string{fiber.HeaderOrigin: shopOrigin}, "", http.StatusOK)
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != shopOrigin {
+		t.Errorf("Access-Control-Allow-Origin: got %q", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderAccessControlExposeHeaders); !strings.Contains(got, "RateLimit-Remaining") {
+		t.Errorf("Access-Control-Expose-Headers: got %q", got)
+	}
+	resp = sendRequest(t, app, fiber.MethodPost, apiOrdersPath, map[string]string{fiber.HeaderOrigin: shopOrigin}, "", http.StatusUnauthorized)
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != shopOrigin {
+		t.Errorf("Access-Control-Allow-Origin of 401: got %q", got)
+	}
+	sendRequest(t, app, fiber.MethodPost, apiOrdersPath, map[string]string{fiber.HeaderOrigin: shopOrigin, auth.HeaderAPIKey: customerKey}, "", http.StatusCreated)
+
+	// Without allowed origins CORS is disabled.
+	app = setupServerApp(t, config.Default().CORS)
+	resp = sendRequest(t, app, fiber.MethodOptions, "/api/orders", map[string]string{
+		fiber.HeaderOrigin:                     shopOrigin,
+		fiber.HeaderAccessControlRequestMethod: fiber.MethodPost,
+	}, "", http.StatusUnauthorized)
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "" {
+		t.Errorf("CORS disabled but Access-Control-Allow-Origin: %q", got)
+	}
+}
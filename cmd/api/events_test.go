@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/events"
+)
+
+// Test that order mutations publish their events once stored.
+func TestOrderEvents(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+	rec := events.NewRecorder(data.Events)
+	defer rec.Close()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "999", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	replaceProduct(t, app, order.ID, getOrder(t, app, order.ID).Products[0].ID, "123", false)
+
+	want := []string{
+		data.EventOrderCreated,
+		data.EventProductAdded,
+		data.EventPaymentRecorded,
+		data.EventOrderStatusChanged,
+		data.EventOrderPaid,
+		data.EventRefundCreated,
+		data.EventProductReplaced,
+		data.EventRefundUpdated,
+	}
+	if got := rec.Names(order.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("events: got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/util"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test that expired orders can be read but no longer changed.
+func TestExpiredOrder(t *testing.T) {
+	t.Parallel()
+	app := fiber.New()
+	app.Use(expiredOrderMiddleware())
+	registerHandlers(app)
+
+	order := createOrder(t, app)
+	stored, _ := util.LoadOrder(order.ID)
+	data.SetStatus(&stored, data.StatusExpired)
+	data.SaveOrder(stored)
+
+	path := apiOrdersPath + "/" + order.ID
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, path, nil, http.StatusOK).Body.Close()
+	performRequestAndCheckStatus(t, app, fiber.MethodPost, path+"/products", bytes.NewBufferString("[123]"), http.StatusBadRequest).Body.Close()
+	performRequestAndCheckStatus(t, app, fiber.MethodPatch, path, bytes.NewBufferString(`{"status": "NEW"}`), http.StatusBadRequest).Body.Close()
+}
+
+// Test that the handlers reject changes of an order expired after the middleware checked it.
+func TestExpiredOrderHandlers(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	stored, _ := util.LoadOrder(order.ID)
+	data.SetStatus(&stored, data.StatusExpired)
+	data.SaveOrder(stored)
+
+	path := apiOrdersPath + "/" + order.ID
+	lineID := stored.Products[0].ID
+	performRequestAndCheckStatus(t, app, fiber.MethodPost, path+"/products", bytes.NewBufferString("[456]"), http.StatusBadRequest).Body.Close()
+	performRequestAndCheckStatus(t, app, fiber.MethodPatch, path, bytes.NewBufferString(`{"status": "NEW"}`), http.StatusBadRequest).Body.Close()
+	performRequestAndCheckStatus(t, app, fiber.MethodPatch, path+"/products/"+lineID, bytes.NewBufferString(`{"quantity": 2}`), http.StatusBadRequest).Body.Close()
+	addPayment(t, app, order.ID, `{"amount": "0.45", "method": "card"}`, http.StatusBadRequest)
+
+	if got := getOrder(t, app, order.ID); got.Status != data.StatusExpired || len(got.Products) != 1 || len(got.Payments) != 0 {
+		t.Errorf("expired order changed: %+v", got)
+	}
+}
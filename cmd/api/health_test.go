@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/buildinfo"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test the probes and build information, which need no authentication.
+func TestHealthEndpoints(t *testing.T) {
+	t.Parallel()
+	app := setupAuthApp(t)
+
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, "/healthz", nil, http.StatusOK).Body.Close()
+
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodGet, "/version", nil, http.StatusOK)
+	var info buildinfo.Info
+	unmarshalResponseBody(t, resp, &info)
+	resp.Body.Close()
+	if info.GoVersion != runtime.Version() || info.Commit == "" {
+		t.Errorf("unexpected build info: %+v", info)
+	}
+
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, "/readyz", nil, http.StatusOK)
+	var ready struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	unmarshalResponseBody(t, resp, &ready)
+	resp.Body.Close()
+	if ready.Status != "ready" || ready.Checks["catalog"] != "ok" {
+		t.Errorf("unexpected readiness: %+v", ready)
+	}
+}
+
+// Test that the readiness probe fails while shutting down.
+// Not parallel: it marks the whole process as shutting down.
+func TestReadinessShutdown(t *testing.T) {
+	app := setupAuthApp(t)
+	api.SetShuttingDown(true)
+	t.Cleanup(func() { api.SetShuttingDown(false) })
+
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, "/readyz", nil, http.StatusServiceUnavailable).Body.Close()
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, "/healthz", nil, http.StatusOK).Body.Close()
+}
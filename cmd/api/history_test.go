@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test GET /api/orders/:order_id/history and GET /api/orders/:order_id?as_of=.
+func TestOrderHistory(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "999", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	replaceProduct(t, app, order.ID, lineID, "123", false)
+
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodGet, apiOrdersPath+"/"+order.ID+"/history", nil, http.StatusOK)
+	var history []data.HistoryEvent
+	unmarshalResponseBody(t, resp, &history)
+	resp.Body.Close()
+
+	if len(history) != 5 {
+		t.Fatalf("history has %d events, want 5: %+v", len(history), history)
+	}
+	// The pending refund is stored with the replacement before the provider issues it.
+	if got := history[3].Events; !reflect.DeepEqual(got, []string{data.EventRefundCreated, data.EventProductReplaced}) {
+		t.Errorf("events of the replacement: got %v", got)
+	}
+	if got := history[4].Events; !reflect.DeepEqual(got, []string{data.EventRefundUpdated}) {
+		t.Errorf("events of the issued refund: got %v", got)
+	}
+
+	// Before the replacement the basket held the TV and was not paid yet.
+	beforePayment := getOrderAsOf(t, app, order.ID, history[1].Time, http.StatusOK)
+	if beforePayment.Status != "NEW" || beforePayment.Products[0].ReplacedWith != nil || beforePayment.Amount.Total != "1333.37" {
+		t.Errorf("unexpected order before payment: %+v", beforePayment)
+	}
+
+	if now := getOrderAsOf(t, app, order.ID, time.Now(), http.StatusOK); !reflect.DeepEqual(now, getOrder(t, app, order.ID)) {
+		t.Errorf("folded order differs from the current one: %+v", now)
+	}
+
+	getOrderAsOf(t, app, order.ID, history[0].Time.Add(-time.Millisecond), http.StatusNotFound)
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, apiOrdersPath+"/"+order.ID+"?as_of=yesterday", nil, http.StatusBadRequest)
+	resp.Body.Close()
+}
+
+func getOrderAsOf(t *testing.T, app *fiber.App, orderID string, at time.Time, expectedStatus int) data.Order {
+	t.Helper()
+	path := apiOrdersPath + "/" + orderID + "?as_of=" + url.QueryEscape(at.Format(time.RFC3339Nano))
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodGet, path, nil, expectedStatus)
+	defer resp.Body.Close()
+
+	var order data.Order
+	if expectedStatus == http.StatusOK {
+		unmarshalResponseBody(t, resp, &order)
+	}
+	return order
+}
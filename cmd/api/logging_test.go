@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/audit"
+	"awesomeProject/pkg/config"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/recover"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// Test that request and business logs carry the request ID, route and order ID.
+// Not parallel: it replaces api.Logger.
+func TestRequestLogging(t *testing.T) {
+	var out bytes.Buffer
+	logger := api.Logger
+	api.Logger = slog.New(slog.NewJSONHandler(&out, nil))
+	defer func() { api.Logger = logger }()
+
+	app := fiber.New()
+	app.Use(requestid.New(), accessLogMiddleware())
+	registerHandlers(app)
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+
+	var statusChanged, request map[string]any
+	for _, entry := range lines {
+		if entry["msg"] == "order status changed" {
+			statusChanged = entry
+		}
+		if entry["msg"] == "request" && entry["method"] == fiber.MethodPatch {
+			request = entry
+		}
+	}
+	for name, entry := range map[string]map[string]any{"status change": statusChanged, "request": request} {
+		if entry == nil {
+			t.Fatalf("no %s log line in %v", name, lines)
+		}
+		if entry["request_id"] == "" || entry["route"] != apiOrdersPath+"/:order_id" || entry["order_id"] != order.ID {
+			t.Errorf("%s log line without request context: %v", name, entry)
+		}
+	}
+	if statusChanged["from"] != "NEW" || statusChanged["to"] != "PAID" {
+		t.Errorf("unexpected status change log: %v", statusChanged)
+	}
+
+	for _, entry := range lines {
+		if entry["msg"] == "request" && entry["route"] == apiOrdersPath && entry["status"] != float64(201) {
+			t.Errorf("unexpected request log of the order creation: %v", entry)
+		}
+	}
+}
+
+// Test that metrics, access logs and audit entries record the status the error handler sends.
+// Not parallel: it replaces api.Logger.
+func TestErrorResponseStatus(t *testing.T) {
+	var out bytes.Buffer
+	logger := api.Logger
+	api.Logger = slog.New(slog.NewJSONHandler(&out, nil))
+	defer func() { api.Logger = logger }()
+
+	auditLog := audit.NewLog()
+	app := fiber.New()
+	app.Use(metricsMiddleware(), requestid.New(), accessLogMiddleware(), auditMiddleware(auditLog), errorMiddleware(), recover.New())
+	app.Post("/test/teapot", func(fiber.Ctx) error { return fiber.NewError(fiber.StatusTeapot, "short and stout") })
+	app.Post("/test/panic", func(fiber.Ctx) error { panic("boom") })
+
+	performRequestAndCheckStatus(t, app, fiber.MethodPost, "/test/teapot", nil, fiber.StatusTeapot).Body.Close()
+	performRequestAndCheckStatus(t, app, fiber.MethodPost, "/test/panic", nil, fiber.StatusInternalServerError).Body.Close()
+
+	want := map[string]int{"/test/teapot": fiber.StatusTeapot, "/test/panic": fiber.StatusInternalServerError}
+	entries, err := auditLog.Entries(audit.Filter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want %d", len(entries), len(want))
+	}
+	for _, entry := range entries {
+		if entry.Status != want[entry.Route] {
+			t.Errorf("audit entry of %s: got status %d, want %d", entry.Route, entry.Status, want[entry.Route])
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		path, _ := entry["path"].(string)
+		if entry["msg"] != "request" || entry["status"] != float64(want[path]) || entry["error"] == nil {
+			t.Errorf("unexpected access log of %s: %v", path, entry)
+		}
+	}
+
+	resp := performRequestAndCheckStatus(t, adminApp(config.Default(), nil), fiber.MethodGet, "/metrics", nil, http.StatusOK)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for route, status := range want {
+		if series := fmt.Sprintf(`http_requests_total{method="POST",route=%q,status="%d"} `, route, status); !strings.Contains(string(body), series) {
+			t.Errorf("metrics do not contain %q", series)
+		}
+	}
+}
@@ -1,21 +1,322 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/audit"
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/certs"
+	"awesomeProject/pkg/config"
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/janitor"
+	"awesomeProject/pkg/ratelimit"
+	"awesomeProject/pkg/tracing"
 
 	"github.com/gofiber/fiber/v3"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+const serviceName = "go-rest-api"
+
 func main() {
-	port := getPort()
+	cfg := getConfig()
+
+	logger, err := setupLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	api.Logger = logger
+
+	// A second signal during the shutdown kills the process right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	if err := run(ctx, cfg); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("server stopped")
+}
+
+// run sets up and serves the API until ctx is done or the listener fails,
+// then shuts it down gracefully.
+func run(ctx context.Context, cfg config.Config) error {
+	if cfg.Catalog.Source != "" {
+		if err := data.LoadProducts(cfg.Catalog.Source); err != nil {
+			return err
+		}
+	}
+	if cfg.Audit.Log != "" {
+		auditLog, err := audit.OpenFile(cfg.Audit.Log)
+		if err != nil {
+			return err
+		}
+		api.AuditLog = auditLog
+	}
+
+	authenticator, err := setupAuth(cfg)
+	if err != nil {
+		return err
+	}
+	if authenticator == nil {
+		slog.Warn("no API keys or token keys configured, authentication is disabled")
+	}
+
+	limits, err := setupRateLimits(cfg)
+	if err != nil {
+		return err
+	}
+
+	if api.TracerProvider, err = setupTracing(cfg); err != nil {
+		return err
+	}
+
+	adminAuth, err := setupAdminAuth(cfg.Admin, authenticator)
+	if err != nil {
+		return err
+	}
+	if adminAuth == nil && cfg.Admin.Listen != "" && !strings.HasPrefix(cfg.Admin.Listen, "unix:") {
+		return fmt.Errorf("admin listener %s: a TCP listener requires authentication", cfg.Admin.Listen)
+	}
+
+	ln, err := listen(cfg.Server.Listen, cfg.TLS)
+	if err != nil {
+		return err
+	}
+	var adminLn net.Listener
+	if cfg.Admin.Listen != "" {
+		if adminLn, err = listenAdmin(cfg.Admin.Listen, cfg.TLS); err != nil {
+			ln.Close()
+			return err
+		}
+	}
 
 	app := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	})
 
-	app.Use(middlewareSetup()...)
+	app.Use(middlewareSetup(cfg.CORS)...)
+	app.Use(ipRateLimitMiddleware(limits))
+	app.Use(authMiddleware(authenticator, publicRoutes, routeRoles))
+	app.Use(rateLimitMiddleware(limits))
+	app.Use(ownershipMiddleware())
+	app.Use(expiredOrderMiddleware())
 
 	setupRoutes(app)
 
-	log.Fatal(app.Listen(port))
+	api.Webhooks.Start(data.Events)
+	api.StartStreams(data.Events)
+	api.StartMetrics(data.Events)
+	sweeper := janitor.New(janitor.Config{
+		TTL:       cfg.Orders.TTL,
+		Retention: cfg.Orders.Retention,
+		Report:    func(_, purged int) { api.ObservePurged(purged) },
+		RetryRefunds: func() int {
+			return api.RetryPendingRefunds(context.Background())
+		},
+	})
+	sweeper.Start()
+
+	apps := []*fiber.App{app}
+	listenErr := make(chan error, 2)
+	go func() {
+		listenErr <- app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	}()
+	slog.Info("listening", "addr", ln.Addr().String(), "tls", cfg.TLS.CertFile != "")
+
+	if adminLn != nil {
+		admin := adminApp(cfg, adminAuth)
+		apps = append(apps, admin)
+		go func() {
+			listenErr <- admin.Listener(adminLn, fiber.ListenConfig{DisableStartupMessage: true})
+		}()
+		slog.Info("admin listening", "addr", cfg.Admin.Listen, "tls", cfg.TLS.CertFile != "" && !strings.HasPrefix(cfg.Admin.Listen, "unix:"))
+	}
+
+	select {
+	case err := <-listenErr:
+		return errors.Join(err, shutdown(apps, cfg, sweeper))
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout)
+		return shutdown(apps, cfg, sweeper)
+	}
+}
+
+// shutdown fails the readiness probe, waits cfg.Server.ShutdownDelay for load balancers
+// to notice, stops accepting connections on the API and admin listeners and drains their
+// in-flight requests for up to cfg.Server.ShutdownTimeout. Then it stops the background
+// workers and closes the audit log and the trace exporter. Orders are kept in memory,
+// there is no store to flush.
+func shutdown(apps []*fiber.App, cfg config.Config, sweeper *janitor.Janitor) error {
+	api.SetShuttingDown(true)
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	// Event streams only end when the client leaves; end them so they do not hold up the drain.
+	api.Streams.Close()
+
+	var errs []error
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, app := range apps {
+		if err := app.ShutdownWithContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("draining requests: %w", err))
+		}
+	}
+
+	sweeper.Stop()
+	api.Webhooks.Stop()
+	data.Events.Close()
+
+	if err := api.AuditLog.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("closing audit log: %w", err))
+	}
+	// Shutting the provider down flushes the spans still batched for the exporter.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelFlush()
+	if err := api.TracerProvider.Shutdown(flushCtx); err != nil {
+		errs = append(errs, fmt.Errorf("closing trace exporter: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// setupLogger returns a logger writing to stderr in the configured format and level.
+func setupLogger(cfg config.Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.Log.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch cfg.Log.Format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", cfg.Log.Format)
+}
+
+// setupAuth returns the authenticator for the configured API keys and token keys,
+// or nil if there are none.
+func setupAuth(cfg config.Config) (*auth.Authenticator, error) {
+	jwt := cfg.Auth.JWT
+	if cfg.Auth.APIKeys == "" && jwt.HMACSecret == "" && jwt.RSAPublicKeyFile == "" && jwt.JWKSFile == "" && cfg.TLS.ClientCAFile == "" {
+		return nil, nil
+	}
+
+	var keys []auth.Key
+	if cfg.Auth.APIKeys != "" {
+		var err error
+		if keys, err = auth.LoadKeys(cfg.Auth.APIKeys); err != nil {
+			return nil, err
+		}
+	}
+	authenticator, err := auth.NewAuthenticator(keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticator.ConfigureJWT(jwt); err != nil {
+		return nil, err
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		if err := authenticator.ConfigureClientCerts(cfg.TLS.ClientRoles); err != nil {
+			return nil, err
+		}
+	}
+	return authenticator, nil
+}
+
+// listen returns the listener of the address, serving TLS if a certificate is configured.
+func listen(addr string, cfg config.TLS) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil || cfg.CertFile == "" {
+		return ln, err
+	}
+
+	reloader, err := certs.NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.ClientCAFile != "" {
+		if tlsConfig.ClientCAs, err = certs.LoadCAPool(cfg.ClientCAFile); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.ClientAuth == "require" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
+// setupRateLimits returns the configured rate limits.
+func setupRateLimits(cfg config.Config) (rateLimits, error) {
+	limits := rateLimits{groups: make(map[string]*ratelimit.Limiter)}
+	for group, limit := range map[string]string{
+		groupRead:  cfg.RateLimits.Read,
+		groupWrite: cfg.RateLimits.Write,
+		groupAdmin: cfg.RateLimits.Admin,
+	} {
+		if limit == "" {
+			continue
+		}
+		rule, err := ratelimit.ParseRule(limit)
+		if err != nil {
+			return rateLimits{}, err
+		}
+		limits.groups[group] = ratelimit.NewLimiter(rule)
+	}
+	if cfg.RateLimits.IP != "" {
+		rule, err := ratelimit.ParseRule(cfg.RateLimits.IP)
+		if err != nil {
+			return rateLimits{}, err
+		}
+		limits.ip = ratelimit.NewLimiter(rule)
+	}
+	if cfg.RateLimits.OrderQuota > 0 {
+		limits.orders = ratelimit.NewQuota(cfg.RateLimits.OrderQuota)
+	}
+	return limits, nil
+}
+
+// setupTracing returns a tracer provider exporting spans as configured.
+func setupTracing(cfg config.Config) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Tracing.Exporter {
+	case "none":
+		return tracing.NewProvider(serviceName, nil), nil
+	case "stdout":
+		exporter, err = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		exporter, err = tracing.NewFileExporter(cfg.Tracing.File)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tracing.NewProvider(serviceName, exporter), nil
 }
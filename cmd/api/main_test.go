@@ -8,9 +8,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/config"
 	"awesomeProject/pkg/data"
 
 	"github.com/gofiber/fiber/v3"
@@ -167,12 +170,33 @@ func setupApp() *fiber.App {
 }
 
 func registerHandlers(app *fiber.App) {
+	app.Get("/healthz", api.Healthz)
+	app.Get("/readyz", api.Readyz)
+	app.Get("/version", api.Version)
 	app.Get(apiProductsPath, api.GetProducts)
 	app.Post(apiOrdersPath, api.CreateOrder)
 	app.Get(apiOrdersPath+"/:order_id", api.GetOrder)
 	app.Patch(apiOrdersPath+"/:order_id", api.UpdateOrderStatus)
 	app.Post("/api/orders/:order_id/products", api.AddProductsToOrder)
 	app.Patch("/api/orders/:order_id/products/:product_id", api.ProductPatchHandler)
+	app.Post("/api/orders/:order_id/payments", api.AddOrderPayment)
+	app.Get("/api/orders/:order_id/payments", api.GetOrderPayments)
+	app.Get("/api/orders/:order_id/events", api.StreamOrderEvents)
+	app.Get("/api/orders/:order_id/history", api.GetOrderHistory)
+	app.Get("/api/admin/events", api.StreamAllEvents)
+	app.Post("/api/orders/:order_id/refunds", api.AddOrderRefund)
+	app.Get("/api/orders/:order_id/refunds", api.GetOrderRefunds)
+	app.Post("/api/orders/:order_id/products/:product_id/returns", api.ReturnOrderProduct)
+	app.Delete("/api/orders/:order_id/products/:product_id/replaced_with", api.UndoReplacementProduct)
+	app.Get("/api/audit", api.GetAuditEntries)
+	app.Get("/api/audit/verify", api.VerifyAuditLog)
+	app.Get("/api/webhooks", api.GetWebhooks)
+	app.Post("/api/webhooks", api.CreateWebhook)
+	app.Get("/api/webhooks/dead-letters", api.GetWebhookDeadLetters)
+	app.Get("/api/webhooks/:webhook_id", api.GetWebhook)
+	app.Patch("/api/webhooks/:webhook_id", api.UpdateWebhook)
+	app.Delete("/api/webhooks/:webhook_id", api.DeleteWebhook)
+	app.Get("/api/webhooks/:webhook_id/deliveries", api.GetWebhookDeliveries)
 }
 
 func performRequestAndCheckStatus(t *testing.T, app *fiber.App, method, path string, body io.Reader, expectedStatus int) *http.Response {
@@ -185,6 +209,41 @@ func performRequestAndCheckStatus(t *testing.T, app *fiber.App, method, path str
 	return resp
 }
 
+// sendRequest performs a request with the headers and body and checks its status.
+// The response body is closed when the test ends.
+func sendRequest(t *testing.T, app *fiber.App, method, path string, headers map[string]string, body string, expectedStatus int) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	checkStatusCode(t, resp, expectedStatus)
+	return resp
+}
+
+// setupServerApp returns an app with the middleware chain of the API server, the
+// CORS configuration and API key authentication of customerKey.
+func setupServerApp(t *testing.T, cors config.CORS) *fiber.App {
+	t.Helper()
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{Name: "web", Role: auth.RoleCustomer, Hash: auth.HashKey(customerKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Use(middlewareSetup(cors)...)
+	app.Use(authMiddleware(authenticator, publicRoutes, routeRoles))
+	setupRoutes(app)
+	return app
+}
+
 func checkStatusCode(t *testing.T, resp *http.Response, want int) {
 	t.Helper()
 	if status := resp.StatusCode; status != want {
@@ -212,6 +271,17 @@ func createOrders(t *testing.T, app *fiber.App) (data.Order, data.Order) {
 	return newOrder, refOrder
 }
 
+// createOrder creates an order on the local API only.
+func createOrder(t *testing.T, app *fiber.App) data.Order {
+	t.Helper()
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath, nil, http.StatusCreated)
+	defer resp.Body.Close()
+
+	var order data.Order
+	unmarshalResponseBody(t, resp, &order)
+	return order
+}
+
 func getOrder(t *testing.T, app *fiber.App, orderID string) data.Order {
 	t.Helper()
 	resp := performRequestAndCheckStatus(t, app, fiber.MethodGet, apiOrdersPath+"/"+orderID, nil, http.StatusOK)
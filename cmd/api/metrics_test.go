@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/config"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test that GET /metrics exposes the request and business metrics.
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	api.StartMetrics(data.Events)
+	app := fiber.New()
+	app.Use(metricsMiddleware())
+	registerHandlers(app)
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	replaceProduct(t, app, order.ID, lineID, "456", false)
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, "/no/such/route", nil, http.StatusNotFound).Body.Close()
+
+	resp := performRequestAndCheckStatus(t, adminApp(config.Default(), nil), fiber.MethodGet, "/metrics", nil, http.StatusOK)
+	defer resp.Body.Close()
+	if got := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type: got %q", got)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		`http_requests_total{method="POST",route="/api/orders",status="201"} `,
+		`http_request_duration_seconds_bucket{method="POST",route="/api/orders/:order_id/products",status="201",le="+Inf"} `,
+		`http_requests_total{method="GET",route="unmatched",status="404"} `,
+		`orders_products_added_total `,
+		`orders_replacements_total{kind="discount"} `,
+		`orders{status="NEW"} `,
+		`orders_store_size `,
+		`# TYPE events_dropped_total counter`,
+		`events_dropped_total{queue="webhook"} `,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
@@ -1,26 +1,178 @@
 package main
 
 import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/audit"
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/config"
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/ratelimit"
+	"awesomeProject/pkg/tracing"
+	"awesomeProject/pkg/util"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/gofiber/fiber/v3/middleware/logger"
 	"github.com/gofiber/fiber/v3/middleware/recover"
 
 	"github.com/gofiber/fiber/v3/middleware/requestid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // middlewareSetup returns a slice of middleware functions for setup
-func middlewareSetup() []any {
+func middlewareSetup(cors config.CORS) []any {
 	return []any{
-		// Set the Cache-Control header for all responses
-		func(c fiber.Ctx) error {
-			c.Set("Cache-Control", "max-age=0, private, must-revalidate")
-			return c.Next()
-		},
-		recover.New(),
+		cacheMiddleware(cachePolicies),
+		metricsMiddleware(),
 		requestid.New(),
-		logger.New(),
+		tracingMiddleware(tracing.Tracer(api.TracerProvider)),
+		accessLogMiddleware(),
+		corsMiddleware(cors, expectedMethods),
+		auditMiddleware(api.AuditLog),
+		errorMiddleware(),
+		recover.New(),
+	}
+}
+
+const handlerErrorKey = "handler.error"
+
+// errorMiddleware answers the errors of the middleware and handlers after it, and the
+// panics recovered after it, with the error handler of the app. The middleware before it
+// then see the status that is sent, and find the error with handlerError.
+func errorMiddleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		err := c.Next()
+		if err == nil {
+			return nil
+		}
+		c.Locals(handlerErrorKey, err)
+		return c.App().ErrorHandler(c, err)
+	}
+}
+
+// handlerError returns the error errorMiddleware answered, if any.
+func handlerError(c fiber.Ctx) error {
+	err, _ := c.Locals(handlerErrorKey).(error)
+	return err
+}
+
+// cacheMiddleware sets the Cache-Control header of the route policy, or of
+// defaultCachePolicy for routes without one. Handlers may override it, as event
+// streams do. Error responses are never stored by shared caches.
+func cacheMiddleware(policies map[*regexp.Regexp]string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		policy := defaultCachePolicy
+		for pattern, p := range policies {
+			if pattern.MatchString(c.Path()) {
+				policy = p
+				break
+			}
+		}
+		c.Set(fiber.HeaderCacheControl, policy)
+
+		err := c.Next()
+		if responseStatus(c, err) >= fiber.StatusBadRequest && strings.HasPrefix(policy, "public") {
+			c.Set(fiber.HeaderCacheControl, defaultCachePolicy)
+		}
+		return err
+	}
+}
+
+// responseStatus returns the status of the response to a request whose handlers returned err.
+// errorMiddleware answers the errors of handlers, so err is only set without it or if the
+// error handler failed; it is reported with the status fiber's default error handler sends.
+func responseStatus(c fiber.Ctx, err error) int {
+	var e *fiber.Error
+	switch {
+	case errors.As(err, &e):
+		return e.Code
+	case err != nil:
+		return fiber.StatusInternalServerError
+	}
+	return c.Response().StatusCode()
+}
+
+// metricsMiddleware counts every request and its latency per route template.
+func metricsMiddleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		route := c.Route().Path
+		if route == "/" {
+			// No endpoint is registered at "/": the request was answered by middleware
+			// or matched no route at all.
+			route = "unmatched"
+		}
+		api.ObserveRequest(route, c.Method(), responseStatus(c, err), time.Since(start))
+		return err
+	}
+}
+
+// tracingMiddleware starts a server span for every request, continuing the trace of an
+// incoming traceparent header, and hands it to the handlers in the user context.
+func tracingMiddleware(tracer trace.Tracer) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		method := strings.Clone(c.Method())
+		ctx := tracing.ContextWithTraceparent(c.UserContext(), c.Get("traceparent"))
+		ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", strings.Clone(c.Path())),
+			attribute.String("request.id", strings.Clone(requestid.FromContext(c))),
+		))
+		defer span.End()
+		c.SetUserContext(ctx)
+		c.Set("traceresponse", tracing.Traceparent(span.SpanContext()))
+
+		err := c.Next()
+
+		route := strings.Clone(c.Route().Path)
+		status := responseStatus(c, err)
+		span.SetName(method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route), attribute.Int("http.response.status_code", status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+// accessLogMiddleware logs every request once it is handled.
+func accessLogMiddleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := responseStatus(c, err)
+		level := slog.LevelInfo
+		switch {
+		case probeRoutes.MatchString(c.Path()) && status < fiber.StatusInternalServerError:
+			// Probes run every few seconds.
+			level = slog.LevelDebug
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs := []any{"method", c.Method(), "path", c.Path(), "status", status, "duration", time.Since(start), "ip", c.IP()}
+		if err == nil {
+			err = handlerError(c)
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		api.RequestLogger(c).Log(c.UserContext(), level, "request", attrs...)
+		return err
 	}
 }
 
@@ -33,6 +185,66 @@ func customErrorHandler(ctx fiber.Ctx, _ error) error {
 	})
 }
 
+// corsMiddleware lets browsers on the allowed origins call the API. Preflight
+// requests are answered here, before authentication, rate limits and
+// methodValidationMiddleware, with the configured methods the path accepts.
+func corsMiddleware(cfg config.CORS, routeMethods map[*regexp.Regexp][]string) fiber.Handler {
+	if len(cfg.AllowOrigins) == 0 {
+		return func(c fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	anyOrigin := slices.Contains(cfg.AllowOrigins, "*")
+	allowHeaders := strings.Join(cfg.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c fiber.Ctx) error {
+		c.Vary(fiber.HeaderOrigin)
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" || !anyOrigin && !slices.Contains(cfg.AllowOrigins, origin) {
+			return c.Next()
+		}
+
+		// Credentials are never allowed with "*", see config.Validate.
+		if anyOrigin {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		}
+		if cfg.AllowCredentials {
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if c.Method() != fiber.MethodOptions || c.Get(fiber.HeaderAccessControlRequestMethod) == "" {
+			if exposeHeaders != "" {
+				c.Set(fiber.HeaderAccessControlExposeHeaders, exposeHeaders)
+			}
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderAccessControlRequestMethod, fiber.HeaderAccessControlRequestHeaders)
+		methods := cfg.AllowMethods
+		for pattern, routeMethods := range routeMethods {
+			if pattern.MatchString(c.Path()) {
+				methods = slices.DeleteFunc(slices.Clone(routeMethods), func(m string) bool {
+					return !slices.Contains(cfg.AllowMethods, m)
+				})
+				break
+			}
+		}
+		c.Set(fiber.HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+		if allowHeaders != "" {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, allowHeaders)
+		}
+		if cfg.MaxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, maxAge)
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
 // methodValidationMiddleware validates the HTTP method for each route
 func methodValidationMiddleware(expectedMethods map[*regexp.Regexp][]string) fiber.Handler {
 	return func(c fiber.Ctx) error {
@@ -54,3 +266,192 @@ func methodValidationMiddleware(expectedMethods map[*regexp.Regexp][]string) fib
 		return c.Next()
 	}
 }
+
+var orderPathPattern = regexp.MustCompile(`^/api/orders/([^/]+)`)
+
+// auditMiddleware records every state-changing request in the audit log,
+// together with the changes it made to the order it targets.
+func auditMiddleware(auditLog *audit.Log) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		err := c.Next()
+
+		orderID := ""
+		if m := orderPathPattern.FindStringSubmatch(c.Path()); m != nil {
+			orderID = m[1]
+		}
+		// The changes are taken from what the handler saved, so changes that
+		// other requests made to the order meanwhile are not attributed to it.
+		var changes map[string]audit.Change
+		var diffErr error
+		if before, after, ok := api.SavedOrder(c); ok {
+			orderID = after.ID
+			changes, diffErr = audit.Diff(before, after)
+		}
+
+		status := responseStatus(c, err)
+
+		// Strings of the context point into buffers that fiber reuses for the next request.
+		_, appendErr := auditLog.Append(audit.Entry{
+			Time:      time.Now().UTC(),
+			Actor:     strings.Clone(clientID(c)),
+			RequestID: strings.Clone(requestid.FromContext(c)),
+			Method:    strings.Clone(c.Method()),
+			Route:     strings.Clone(c.Route().Path),
+			Path:      strings.Clone(c.Path()),
+			Status:    status,
+			OrderID:   strings.Clone(orderID),
+			Changes:   changes,
+		})
+		if appendErr = errors.Join(diffErr, appendErr); appendErr != nil {
+			api.RequestLogger(c).Error("audit log append failed", "error", appendErr)
+		}
+		return err
+	}
+}
+
+// clientID identifies who made the request: the authenticated principal or the client IP.
+func clientID(c fiber.Ctx) string {
+	if p, ok := auth.PrincipalFrom(c); ok {
+		return p.Role + ":" + p.Subject
+	}
+	return "ip:" + c.IP()
+}
+
+// authMiddleware authenticates every request outside publicRoutes and checks
+// the roles required by routeRoles. A nil authenticator disables authentication.
+func authMiddleware(authenticator *auth.Authenticator, publicRoutes *regexp.Regexp, routeRoles map[*regexp.Regexp]map[string][]string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if authenticator == nil || publicRoutes.MatchString(c.Path()) {
+			return c.Next()
+		}
+
+		p, err := authenticator.Authenticate(c)
+		if err != nil {
+			return auth.Error(c, fiber.StatusUnauthorized)
+		}
+		auth.SetPrincipal(c, p)
+
+		for pattern, methods := range routeRoles {
+			if roles, ok := methods[c.Method()]; ok && pattern.MatchString(c.Path()) && !auth.Allowed(c, roles...) {
+				return auth.Error(c, fiber.StatusForbidden)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// ownershipMiddleware restricts customers to the orders they created; staff may access every order.
+// Orders of other customers are reported as missing, so order IDs cannot be probed.
+func ownershipMiddleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		p, ok := auth.PrincipalFrom(c)
+		m := orderPathPattern.FindStringSubmatch(c.Path())
+		if !ok || p.IsStaff() || m == nil {
+			return c.Next()
+		}
+		if order, found := util.LoadOrder(m[1]); found && order.Owner != p.Owner() {
+			return c.Status(fiber.StatusNotFound).JSON("Not Found")
+		}
+		return c.Next()
+	}
+}
+
+// rateLimits holds the token bucket limiters of the client IP addresses and the route groups,
+// and the daily order creation quota. A nil limiter or quota is not enforced.
+type rateLimits struct {
+	ip     *ratelimit.Limiter
+	groups map[string]*ratelimit.Limiter
+	orders *ratelimit.Quota
+}
+
+// ipRateLimitMiddleware limits the requests of every client IP address. It runs before
+// authentication, so that requests with wrong credentials are limited as well.
+func ipRateLimitMiddleware(limits rateLimits) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if limits.ip == nil || rateLimitGroup(c.Path(), c.Method()) == "" {
+			return c.Next()
+		}
+		d := limits.ip.Allow("ip:"+c.IP(), time.Now())
+		setRateLimitHeaders(c, d.Limit, d.Remaining, d.Reset)
+		if !d.Allowed {
+			return tooManyRequests(c, d.RetryAfter)
+		}
+		return c.Next()
+	}
+}
+
+// rateLimitMiddleware limits the requests of every client per route group and its
+// daily order creations, and reports the most restrictive limit in the RateLimit-* headers.
+func rateLimitMiddleware(limits rateLimits) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		client := clientID(c)
+		now := time.Now()
+
+		if limiter := limits.groups[rateLimitGroup(c.Path(), c.Method())]; limiter != nil {
+			d := limiter.Allow(client, now)
+			reportRateLimit(c, d.Limit, d.Remaining, d.Reset)
+			if !d.Allowed {
+				return tooManyRequests(c, d.RetryAfter)
+			}
+		}
+
+		if limits.orders != nil && c.Method() == fiber.MethodPost && c.Path() == "/api/orders" {
+			allowed, remaining, reset := limits.orders.Use(client, now)
+			if !allowed {
+				setRateLimitHeaders(c, limits.orders.Limit(), 0, reset)
+				return tooManyRequests(c, reset)
+			}
+			reportRateLimit(c, limits.orders.Limit(), remaining, reset)
+		}
+		return c.Next()
+	}
+}
+
+// reportRateLimit sets the RateLimit-* headers unless an earlier limit leaves fewer requests.
+func reportRateLimit(c fiber.Ctx, limit, remaining int, reset time.Duration) {
+	if current, _ := strconv.Atoi(c.GetRespHeader("RateLimit-Remaining")); c.GetRespHeader("RateLimit-Limit") == "" || remaining < current {
+		setRateLimitHeaders(c, limit, remaining, reset)
+	}
+}
+
+func setRateLimitHeaders(c fiber.Ctx, limit, remaining int, reset time.Duration) {
+	c.Set("RateLimit-Limit", strconv.Itoa(limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("RateLimit-Reset", seconds(reset))
+}
+
+func tooManyRequests(c fiber.Ctx, retryAfter time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, seconds(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"errors": fiber.Map{
+			"detail": "Too Many Requests",
+		},
+	})
+}
+
+// seconds formats a duration as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// expiredOrderMiddleware rejects changes to expired orders early. The janitor may
+// still expire an order after this check, so the handlers check the status again
+// while holding the lock of the order, and save it only if it did not change.
+func expiredOrderMiddleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		m := orderPathPattern.FindStringSubmatch(c.Path())
+		if m == nil || c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			return c.Next()
+		}
+		if order, ok := util.LoadOrder(m[1]); ok && order.Status == data.StatusExpired {
+			return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"awesomeProject/pkg/api"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+var (
+	mergePatch = map[string]string{fiber.HeaderContentType: api.MIMEMergePatch}
+	jsonPatch  = map[string]string{fiber.HeaderContentType: api.MIMEJSONPatch}
+)
+
+// Test that a merge patch changes quantity and replacement in one call.
+func TestMergePatchOrderProduct(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	path := apiOrdersPath + "/" + order.ID + "/products/" + lineID
+
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch, `{"quantity": 2, "unknown": 1}`, http.StatusBadRequest)
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch,
+		`{"quantity": 2, "replaced_with": {"product_id": 456, "quantity": 1}}`, http.StatusOK)
+
+	patched := getOrder(t, app, order.ID)
+	line := patched.Products[0]
+	if line.Quantity != 2 || line.ReplacedWith == nil || line.ReplacedWith.ProductID != 456 {
+		t.Fatalf("unexpected line: %+v", line)
+	}
+	// 2.33 replaces 2 x 0.45
+	if want := "0.00/1.43/0.90"; amounts(patched) != want {
+		t.Errorf("amounts: got %s want %s", amounts(patched), want)
+	}
+
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch, `{"replaced_with": null}`, http.StatusOK)
+	if line := getOrder(t, app, order.ID).Products[0]; line.ReplacedWith != nil {
+		t.Errorf("replacement not undone: %+v", line)
+	}
+}
+
+// Test the total after a merge patch changes quantity and replacement of a replaced line.
+func TestMergePatchReplacedLineTotal(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	path := apiOrdersPath + "/" + order.ID + "/products/" + lineID
+	replaceWith(t, app, order.ID, lineID, 879, 1) // 0.42 replaces 0.45
+
+	// 2 x 0.45 replaces 0.42: a discount, the total stays 0.42.
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch,
+		`{"quantity": 2, "replaced_with": {"product_id": 123, "quantity": 2}}`, http.StatusOK)
+	patched := getOrder(t, app, order.ID)
+	if want := "0.00/0.48/0.42"; amounts(patched) != want {
+		t.Errorf("amounts: got %s want %s", amounts(patched), want)
+	}
+
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch, `{"quantity": 3, "replaced_with": null}`, http.StatusOK)
+	undone := getOrder(t, app, order.ID)
+	if want := "0.00/0.00/0.42"; amounts(undone) != want {
+		t.Errorf("amounts after undo: got %s want %s", amounts(undone), want)
+	}
+}
+
+// Test that a JSON patch is applied atomically.
+func TestJSONPatchOrderProductAtomic(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	path := apiOrdersPath + "/" + order.ID + "/products/" + lineID
+
+	// The replacement of a missing catalog product fails after the quantity was changed.
+	sendRequest(t, app, fiber.MethodPatch, path, jsonPatch, `[
+		{"op": "replace", "path": "/quantity", "value": 3},
+		{"op": "add", "path": "/replaced_with", "value": {"product_id": 1, "quantity": 1}}
+	]`, http.StatusNotFound)
+	sendRequest(t, app, fiber.MethodPatch, path, jsonPatch, `[
+		{"op": "replace", "path": "/quantity", "value": 3},
+		{"op": "test", "path": "/quantity", "value": 4}
+	]`, http.StatusConflict)
+
+	if got := getOrder(t, app, order.ID); got.Products[0].Quantity != 1 || got.Amount.Total != "0.45" {
+		t.Fatalf("order changed by failed patch: %+v", got)
+	}
+
+	sendRequest(t, app, fiber.MethodPatch, path, jsonPatch, `[
+		{"op": "test", "path": "/name", "value": "Ketchup"},
+		{"op": "replace", "path": "/quantity", "value": 3},
+		{"op": "test", "path": "/quantity", "value": 3}
+	]`, http.StatusOK)
+	if got := getOrder(t, app, order.ID).Amount.Total; got != "1.35" {
+		t.Errorf("total: got %s want 1.35", got)
+	}
+}
+
+// Test PATCH /api/orders/:order_id with a merge patch and a JSON patch.
+func TestPatchOrderStatus(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	path := apiOrdersPath + "/" + order.ID
+
+	sendRequest(t, app, fiber.MethodPatch, path, jsonPatch,
+		`[{"op": "test", "path": "/status", "value": "PAID"}, {"op": "replace", "path": "/status", "value": "PAID"}]`,
+		http.StatusConflict)
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch, `{"status": "PAID", "id": "x"}`, http.StatusBadRequest)
+	sendRequest(t, app, fiber.MethodPatch, path, mergePatch, `{"status": "PAID"}`, http.StatusOK)
+
+	if got := getOrder(t, app, order.ID).Status; got != "PAID" {
+		t.Errorf("status: got %s want PAID", got)
+	}
+}
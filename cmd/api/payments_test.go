@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/payment"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test POST /api/orders/:order_id/payments - partial payments add up to PAID.
+func TestPartialPayments(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false) // 2.33
+
+	addPayment(t, app, order.ID, `{"amount": "1.00", "method": "cash"}`, http.StatusCreated)
+
+	partial := getOrder(t, app, order.ID)
+	if partial.Status != "NEW" || partial.Amount.Paid != "1.00" {
+		t.Errorf("unexpected order after partial payment: status %s paid %s", partial.Status, partial.Amount.Paid)
+	}
+
+	// Paying more than the outstanding amount is rejected.
+	addPayment(t, app, order.ID, `{"amount": "2.00", "method": "card"}`, http.StatusBadRequest)
+	addPayment(t, app, order.ID, `{"amount": "1.33", "method": "card", "reference": "txn-1"}`, http.StatusCreated)
+
+	paid := getOrder(t, app, order.ID)
+	if paid.Status != "PAID" || paid.Amount.Paid != "2.33" {
+		t.Errorf("unexpected order after full payment: status %s paid %s", paid.Status, paid.Amount.Paid)
+	}
+	if len(paid.Payments) != 2 || paid.Payments[1].Reference != "txn-1" {
+		t.Errorf("unexpected payments: %+v", paid.Payments)
+	}
+
+	addPayment(t, app, order.ID, `{"amount": "0.01", "method": "cash"}`, http.StatusBadRequest)
+}
+
+// Test that payment amounts need exactly two decimals instead of being rounded.
+func TestPaymentAmountFormat(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false) // 2.33
+
+	for _, amount := range []string{"1", "1.0", "0.005", "12.345", "1e2", " 5.00", "5.00 ", "-1.00", "+1.00", "NaN", "0x1p-2"} {
+		addPayment(t, app, order.ID, `{"amount": "`+amount+`", "method": "cash"}`, http.StatusBadRequest)
+	}
+	if paid := getOrder(t, app, order.ID).Amount.Paid; paid != "0.00" {
+		t.Errorf("rejected amounts were recorded: paid %s", paid)
+	}
+	addPayment(t, app, order.ID, `{"amount": "2.33", "method": "cash"}`, http.StatusCreated)
+}
+
+// Test PATCH /api/orders/:order_id - marking an order PAID records the payment.
+func TestUpdateOrderStatusRecordsPayment(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	addPayment(t, app, order.ID, `{"amount": "0.20", "method": "cash"}`, http.StatusCreated)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+
+	paid := getOrder(t, app, order.ID)
+	if paid.Amount.Paid != paid.Amount.Total || len(paid.Payments) != 2 {
+		t.Fatalf("unexpected order: %+v", paid)
+	}
+	if last := paid.Payments[1]; last.Method != "manual" || last.Amount != "0.25" {
+		t.Errorf("unexpected settling payment: %+v", last)
+	}
+}
+
+// Test that concurrent payments of the outstanding amount capture and record it only once.
+func TestConcurrentPayments(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+
+	const requests = 8
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(fiber.MethodPost, apiOrdersPath+"/"+order.ID+"/payments",
+				bytes.NewBufferString(`{"amount": "2.33", "method": "card"}`))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+		}
+	}
+	paid := getOrder(t, app, order.ID)
+	if created != 1 || len(paid.Payments) != 1 || paid.Amount.Paid != "2.33" || paid.Status != "PAID" {
+		t.Errorf("%d payments created, order %+v", created, paid)
+	}
+}
+
+// Test that concurrent changes of an order neither drop payments nor each other.
+func TestConcurrentOrderChanges(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+
+	const requests = 8
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			addPayment(t, app, order.ID, `{"amount": "0.01", "method": "card"}`, http.StatusCreated)
+		}()
+		go func() {
+			defer wg.Done()
+			addProduct(t, app, order.ID, "123", false)
+		}()
+	}
+	wg.Wait()
+
+	changed := getOrder(t, app, order.ID)
+	if len(changed.Payments) != requests || changed.Amount.Paid != "0.08" {
+		t.Errorf("payments lost: %+v", changed.Payments)
+	}
+	if len(changed.Products) != 2 || changed.Products[1].Quantity != requests || changed.Amount.Total != "5.93" {
+		t.Errorf("products lost: %+v, total %s", changed.Products, changed.Amount.Total)
+	}
+}
+
+func addPayment(t *testing.T, app *fiber.App, orderID, body string, expectedStatus int) {
+	t.Helper()
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath+"/"+orderID+"/payments",
+		bytes.NewBufferString(body), expectedStatus)
+	resp.Body.Close()
+}
+
+// Test PATCH /api/orders/:order_id - the order only becomes PAID after a successful capture.
+// Not parallel: it scripts the shared fake provider.
+func TestUpdateOrderStatusProviderFailures(t *testing.T) {
+	app := setupApp()
+	provider := api.PaymentProvider.(*payment.Fake)
+
+	timeout := api.ProviderTimeout
+	api.ProviderTimeout = 10 * time.Millisecond
+	defer func() { api.ProviderTimeout = timeout }()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+
+	for _, tc := range []struct {
+		outcome payment.Outcome
+		status  int
+	}{
+		{payment.Decline, http.StatusPaymentRequired},
+		{payment.Timeout, http.StatusGatewayTimeout},
+	} {
+		provider.Script(tc.outcome)
+		resp := performRequestAndCheckStatus(t, app, fiber.MethodPatch, apiOrdersPath+"/"+order.ID,
+			bytes.NewBufferString(`{"status": "PAID"}`), tc.status)
+		resp.Body.Close()
+
+		if got := getOrder(t, app, order.ID); got.Status != "NEW" || len(got.Payments) != 0 {
+			t.Errorf("order changed after failed capture: %+v", got)
+		}
+	}
+
+	// Authorization succeeds but the capture is declined, so the authorization is voided.
+	voided := provider.Count(payment.StatusVoided)
+	provider.Script(payment.Succeed, payment.Decline)
+	addPayment(t, app, order.ID, `{"amount": "0.45", "method": "card"}`, http.StatusPaymentRequired)
+	if n := provider.Count(payment.StatusVoided) - voided; n != 1 {
+		t.Errorf("voided authorizations: got %d want 1", n)
+	}
+
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	paid := getOrder(t, app, order.ID)
+	if paid.Status != "PAID" || len(paid.Payments) != 1 || paid.Payments[0].ProviderRef == "" {
+		t.Errorf("unexpected order after capture: %+v", paid)
+	}
+}
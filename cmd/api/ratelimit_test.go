@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/ratelimit"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test the write rate limit and the daily order quota of a client.
+func TestRateLimits(t *testing.T) {
+	t.Parallel()
+	newApp := func(limits rateLimits) *fiber.App {
+		app := fiber.New()
+		app.Use(rateLimitMiddleware(limits))
+		registerHandlers(app)
+		return app
+	}
+
+	app := newApp(rateLimits{groups: map[string]*ratelimit.Limiter{
+		groupWrite: ratelimit.NewLimiter(ratelimit.Rule{Rate: 0.001, Burst: 2}),
+	}})
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath, nil, http.StatusCreated)
+	resp.Body.Close()
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "1" || resp.Header.Get("RateLimit-Limit") != "2" {
+		t.Errorf("RateLimit-Remaining: got %q, want 1", got)
+	}
+	performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath, nil, http.StatusCreated).Body.Close()
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath, nil, http.StatusTooManyRequests)
+	resp.Body.Close()
+	if resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Error("429 without Retry-After")
+	}
+	// Reads are limited separately.
+	performRequestAndCheckStatus(t, app, fiber.MethodGet, apiProductsPath, nil, http.StatusOK).Body.Close()
+
+	app = newApp(rateLimits{orders: ratelimit.NewQuota(1)})
+	performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath, nil, http.StatusCreated).Body.Close()
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath, nil, http.StatusTooManyRequests)
+	var body struct {
+		Errors struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	unmarshalResponseBody(t, resp, &body)
+	resp.Body.Close()
+	if body.Errors.Detail != "Too Many Requests" || resp.Header.Get("RateLimit-Limit") != "1" {
+		t.Errorf("unexpected quota response: %+v %v", body, resp.Header)
+	}
+}
+
+// Test that client IP addresses are limited before authentication, so wrong keys cannot be tried without limit.
+func TestIPRateLimit(t *testing.T) {
+	t.Parallel()
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{Name: "web", Role: auth.RoleCustomer, Hash: auth.HashKey(customerKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := rateLimits{
+		ip: ratelimit.NewLimiter(ratelimit.Rule{Rate: 0.001, Burst: 3}),
+		groups: map[string]*ratelimit.Limiter{
+			groupWrite: ratelimit.NewLimiter(ratelimit.Rule{Rate: 0.001, Burst: 5}),
+		},
+	}
+	app := fiber.New()
+	app.Use(ipRateLimitMiddleware(limits))
+	app.Use(authMiddleware(authenticator, publicRoutes, routeRoles))
+	app.Use(rateLimitMiddleware(limits))
+	registerHandlers(app)
+
+	// The most restrictive limit is reported.
+	resp := authRequest(t, app, fiber.MethodPost, apiOrdersPath, customerKey, "", http.StatusCreated)
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "2" || resp.Header.Get("RateLimit-Limit") != "3" {
+		t.Errorf("RateLimit headers: got %q of %q, want 2 of 3", got, resp.Header.Get("RateLimit-Limit"))
+	}
+	authRequest(t, app, fiber.MethodPost, apiOrdersPath, "wrong-key", "", http.StatusUnauthorized)
+	authRequest(t, app, fiber.MethodPost, apiOrdersPath, "wrong-key", "", http.StatusUnauthorized)
+	resp = authRequest(t, app, fiber.MethodPost, apiOrdersPath, "wrong-key", "", http.StatusTooManyRequests)
+	if resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Error("429 without Retry-After")
+	}
+	authRequest(t, app, fiber.MethodPost, apiOrdersPath, customerKey, "", http.StatusTooManyRequests)
+	// Probes are not limited.
+	authRequest(t, app, fiber.MethodGet, "/version", "", "", http.StatusOK)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/payment"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test that a cheaper replacement on a PAID order issues a refund.
+func TestReplacementRefund(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addRefund(t, app, order.ID, `{"amount": "1.00"}`, http.StatusBadRequest) // not paid yet
+
+	addProduct(t, app, order.ID, "999", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	replaceProduct(t, app, order.ID, lineID, "123", false)
+
+	refunds := getRefunds(t, app, order.ID)
+	if len(refunds) != 1 || refunds[0].Status != data.RefundIssued || refunds[0].Source != data.RefundSourceReplacement {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+	if got := getOrder(t, app, order.ID).Amount.Returns; got != "1330.67" || refunds[0].Amount != got {
+		t.Errorf("returns %s do not match issued refund %s", got, refunds[0].Amount)
+	}
+
+	// Only 2.70 of the payment is left to refund.
+	addRefund(t, app, order.ID, `{"amount": "2.71", "reason": "goodwill"}`, http.StatusBadRequest)
+}
+
+// Test that a declined refund is kept as failed and not counted in returns.
+// Not parallel: it scripts the shared fake provider.
+func TestManualRefundDeclined(t *testing.T) {
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+
+	api.PaymentProvider.(*payment.Fake).Script(payment.Decline)
+	addRefund(t, app, order.ID, `{"amount": "1.00", "reason": "damaged"}`, http.StatusCreated)
+	addRefund(t, app, order.ID, `{"amount": "0.50", "reason": "damaged"}`, http.StatusCreated)
+
+	refunds := getRefunds(t, app, order.ID)
+	if len(refunds) != 2 || refunds[0].Status != data.RefundFailed || refunds[1].Status != data.RefundIssued {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+	if got := getOrder(t, app, order.ID).Amount.Returns; got != "0.50" {
+		t.Errorf("returns: got %s want 0.50", got)
+	}
+}
+
+// Test that a refund left pending by a provider timeout is issued by a retry, once.
+// Not parallel: it scripts the shared fake provider.
+func TestPendingRefundRetried(t *testing.T) {
+	app := setupApp()
+	timeout := api.ProviderTimeout
+	api.ProviderTimeout = 10 * time.Millisecond
+	defer func() { api.ProviderTimeout = timeout }()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+
+	api.PaymentProvider.(*payment.Fake).Script(payment.Timeout)
+	addRefund(t, app, order.ID, `{"amount": "1.00", "reason": "damaged"}`, http.StatusCreated)
+	if refunds := getRefunds(t, app, order.ID); len(refunds) != 1 || refunds[0].Status != data.RefundPending {
+		t.Fatalf("unexpected refunds after timeout: %+v", refunds)
+	}
+
+	if resolved := api.RetryPendingRefunds(context.Background()); resolved < 1 {
+		t.Errorf("resolved %d refunds, want at least 1", resolved)
+	}
+	refunds := getRefunds(t, app, order.ID)
+	if len(refunds) != 1 || refunds[0].Status != data.RefundIssued || refunds[0].ProviderRef == "" {
+		t.Fatalf("unexpected refunds after retry: %+v", refunds)
+	}
+	if got := getOrder(t, app, order.ID).Amount.Returns; got != "1.00" {
+		t.Errorf("returns: got %s want 1.00", got)
+	}
+
+	// Retrying with the same idempotency key does not refund again.
+	paid := getOrder(t, app, order.ID).Payments[0].ProviderRef
+	tx, err := api.PaymentProvider.Refund(context.Background(), paid, "1.00", refunds[0].ID)
+	if err != nil || tx.ID != refunds[0].ProviderRef {
+		t.Errorf("repeated refund: got %+v, %v, want transaction %s", tx, err, refunds[0].ProviderRef)
+	}
+}
+
+// Test that a refund larger than the last capture is split across the captures.
+func TestRefundSplitAcrossCaptures(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false) // 2.33
+	addPayment(t, app, order.ID, `{"amount": "1.00", "method": "card"}`, http.StatusCreated)
+	addPayment(t, app, order.ID, `{"amount": "1.33", "method": "card"}`, http.StatusCreated)
+	payments := getOrder(t, app, order.ID).Payments
+
+	addRefund(t, app, order.ID, `{"amount": "2.00", "reason": "damaged"}`, http.StatusCreated)
+	addRefund(t, app, order.ID, `{"amount": "0.33", "reason": "damaged"}`, http.StatusCreated)
+
+	refunds := getRefunds(t, app, order.ID)
+	if len(refunds) != 2 || refunds[0].Status != data.RefundIssued || refunds[1].Status != data.RefundIssued {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+	want := [][]data.RefundPart{
+		{{CaptureID: payments[1].ProviderRef, Amount: "1.33"}, {CaptureID: payments[0].ProviderRef, Amount: "0.67"}},
+		{{CaptureID: payments[0].ProviderRef, Amount: "0.33"}},
+	}
+	for i, refund := range refunds {
+		if len(refund.Parts) != len(want[i]) {
+			t.Fatalf("parts of refund %d: got %+v want %+v", i, refund.Parts, want[i])
+		}
+		for j, part := range refund.Parts {
+			if part.CaptureID != want[i][j].CaptureID || part.Amount != want[i][j].Amount || part.ProviderRef == "" {
+				t.Errorf("part %d of refund %d: got %+v want %+v", j, i, part, want[i][j])
+			}
+		}
+	}
+	if got := getOrder(t, app, order.ID).Amount.Returns; got != "2.33" {
+		t.Errorf("returns: got %s want 2.33", got)
+	}
+}
+
+// Test that a split refund whose second part is declined is issued for its first part.
+// Not parallel: it scripts the shared fake provider.
+func TestSplitRefundPartlyDeclined(t *testing.T) {
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	addPayment(t, app, order.ID, `{"amount": "1.00", "method": "card"}`, http.StatusCreated)
+	addPayment(t, app, order.ID, `{"amount": "1.33", "method": "card"}`, http.StatusCreated)
+
+	api.PaymentProvider.(*payment.Fake).Script(payment.Succeed, payment.Decline)
+	addRefund(t, app, order.ID, `{"amount": "2.00", "reason": "damaged"}`, http.StatusCreated)
+
+	refunds := getRefunds(t, app, order.ID)
+	if len(refunds) != 1 || refunds[0].Status != data.RefundIssued || refunds[0].Amount != "1.33" {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+	if got := getOrder(t, app, order.ID).Amount.Returns; got != "1.33" {
+		t.Errorf("returns: got %s want 1.33", got)
+	}
+}
+
+// Test that concurrent refunds are paid out only as often as they are recorded.
+func TestConcurrentRefunds(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+
+	const requests = 8
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(fiber.MethodPost, apiOrdersPath+"/"+order.ID+"/refunds",
+				bytes.NewBufferString(`{"amount": "1.00", "reason": "damaged"}`))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+		}
+	}
+	refunds := getRefunds(t, app, order.ID)
+	if created != 2 || len(refunds) != 2 || getOrder(t, app, order.ID).Amount.Returns != "2.00" {
+		t.Errorf("%d refunds created, %d recorded: %+v", created, len(refunds), refunds)
+	}
+}
+
+func addRefund(t *testing.T, app *fiber.App, orderID, body string, expectedStatus int) {
+	t.Helper()
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPost, apiOrdersPath+"/"+orderID+"/refunds",
+		bytes.NewBufferString(body), expectedStatus)
+	resp.Body.Close()
+}
+
+func getRefunds(t *testing.T, app *fiber.App, orderID string) []data.Refund {
+	t.Helper()
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodGet, apiOrdersPath+"/"+orderID+"/refunds", nil, http.StatusOK)
+	defer resp.Body.Close()
+
+	var refunds []data.Refund
+	unmarshalResponseBody(t, resp, &refunds)
+	return refunds
+}
+
+// Test POST /api/orders/:order_id/products/:product_id/returns - return part of a paid line.
+func TestReturnOrderProduct(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	addProduct(t, app, order.ID, "456", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+
+	returnProduct(t, app, order.ID, lineID, 1, http.StatusBadRequest) // not paid yet
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+
+	returnProduct(t, app, order.ID, "unknown", 1, http.StatusNotFound)
+	returnProduct(t, app, order.ID, lineID, 0, http.StatusBadRequest)
+	returnProduct(t, app, order.ID, lineID, 1, http.StatusCreated)
+	returnProduct(t, app, order.ID, lineID, 2, http.StatusBadRequest) // only one left
+
+	returned := getOrder(t, app, order.ID)
+	if returned.Products[0].ReturnedQuantity != 1 {
+		t.Errorf("returned quantity: got %d want 1", returned.Products[0].ReturnedQuantity)
+	}
+	if returned.Amount.Returns != "2.33" || returned.Amount.Total != "2.33" || returned.Amount.Paid != "4.66" {
+		t.Errorf("unexpected amounts: %+v", returned.Amount)
+	}
+}
+
+// Test that a replaced line returns the replacement's items, refunding no more than was paid.
+func TestReturnReplacedProduct(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	replaceProduct(t, app, order.ID, lineID, "123", false) // 6 x 0.45, discount 0.37
+
+	returnProduct(t, app, order.ID, lineID, 7, http.StatusBadRequest)
+	returnProduct(t, app, order.ID, lineID, 6, http.StatusCreated)
+
+	if got := getOrder(t, app, order.ID).Amount.Returns; got != "2.33" {
+		t.Errorf("returns: got %s want 2.33", got)
+	}
+}
+
+// Test that returns of a fully refunded order are rejected with 409 instead of a zero refund.
+func TestReturnFullyRefundedOrder(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	addRefund(t, app, order.ID, `{"amount": "2.33", "reason": "goodwill"}`, http.StatusCreated)
+
+	returnProduct(t, app, order.ID, lineID, 1, http.StatusConflict)
+	returned := getOrder(t, app, order.ID)
+	if returned.Products[0].ReturnedQuantity != 0 || len(returned.Refunds) != 1 {
+		t.Errorf("order changed by a rejected return: %+v", returned)
+	}
+}
+
+func returnProduct(t *testing.T, app *fiber.App, orderID, lineID string, quantity, expectedStatus int) {
+	t.Helper()
+	body := bytes.NewBufferString(fmt.Sprintf(`{"quantity": %d}`, quantity))
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPost,
+		apiOrdersPath+"/"+orderID+"/products/"+lineID+"/returns", body, expectedStatus)
+	resp.Body.Close()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test that each replacement is compared against the item it replaces and can be undone.
+func TestReplacementChain(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "999", false)
+	updateOrderStatus(t, app, order.ID, "PAID", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+
+	replaceProduct(t, app, order.ID, lineID, "123", false) // 6 x 0.45 = 2.70
+	replaceWith(t, app, order.ID, lineID, 456, 2)          // 2 x 2.33 = 4.66
+
+	replaced := getOrder(t, app, order.ID)
+	line := replaced.Products[0]
+	if len(line.Replacements) != 2 || line.ReplacedWith == nil || line.ReplacedWith.ProductID != 456 {
+		t.Fatalf("unexpected replacement chain: %+v", line)
+	}
+	if want := "1330.67/1.96/2.70"; amounts(replaced) != want {
+		t.Errorf("amounts: got %s want %s", amounts(replaced), want)
+	}
+
+	undoReplacement(t, app, order.ID, lineID, http.StatusOK)
+
+	undone := getOrder(t, app, order.ID)
+	line = undone.Products[0]
+	if len(line.Replacements) != 1 || line.ReplacedWith.ProductID != 123 {
+		t.Fatalf("unexpected replacement chain after undo: %+v", line)
+	}
+	if want := "1330.67/0.00/2.70"; amounts(undone) != want {
+		t.Errorf("amounts after undo: got %s want %s", amounts(undone), want)
+	}
+
+	// The first replacement was refunded already.
+	undoReplacement(t, app, order.ID, lineID, http.StatusConflict)
+}
+
+// Test undoing a cheaper replacement on an unpaid order restores the total.
+func TestUndoReplacementNewOrder(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "456", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+
+	undoReplacement(t, app, order.ID, lineID, http.StatusNotFound)
+	replaceWith(t, app, order.ID, lineID, 123, 1)
+	if got := getOrder(t, app, order.ID).Amount.Total; got != "0.45" {
+		t.Errorf("total after replacement: got %s want 0.45", got)
+	}
+
+	undoReplacement(t, app, order.ID, lineID, http.StatusOK)
+	undone := getOrder(t, app, order.ID)
+	if undone.Amount.Total != "2.33" || undone.Products[0].ReplacedWith != nil {
+		t.Errorf("unexpected order after undo: %+v", undone)
+	}
+}
+
+// amounts formats returns/discount/total for compact comparisons.
+func amounts(order data.Order) string {
+	return order.Amount.Returns + "/" + order.Amount.Discount + "/" + order.Amount.Total
+}
+
+func replaceWith(t *testing.T, app *fiber.App, orderID, lineID string, productID, quantity int) {
+	t.Helper()
+	body := bytes.NewBufferString(fmt.Sprintf(`{"replaced_with": {"product_id": %d, "quantity": %d}}`, productID, quantity))
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPatch, apiOrdersPath+"/"+orderID+"/products/"+lineID, body, http.StatusOK)
+	resp.Body.Close()
+}
+
+func undoReplacement(t *testing.T, app *fiber.App, orderID, lineID string, expectedStatus int) {
+	t.Helper()
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodDelete,
+		apiOrdersPath+"/"+orderID+"/products/"+lineID+"/replaced_with", nil, expectedStatus)
+	resp.Body.Close()
+}
+
+// Test that adding products or changing quantities keeps what replacements did to the total.
+func TestTotalAfterReplacement(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	lineID := getOrder(t, app, order.ID).Products[0].ID
+	replaceWith(t, app, order.ID, lineID, 879, 1) // 0.45 -> 0.42
+
+	addProduct(t, app, order.ID, "879", false) // 0.42
+	if got := getOrder(t, app, order.ID).Amount.Total; got != "0.84" {
+		t.Errorf("total after adding a product: got %s want 0.84", got)
+	}
+
+	addProduct(t, app, order.ID, "456", false) // 2.33
+	products := getOrder(t, app, order.ID).Products
+	replaceWith(t, app, order.ID, products[2].ID, 999, 1) // a discount, the total is unchanged
+
+	resp := sendRequest(t, app, fiber.MethodPatch, "/api/orders/"+order.ID+"/products/"+products[1].ID,
+		map[string]string{fiber.HeaderContentType: fiber.MIMEApplicationJSON}, `{"quantity": 3}`, http.StatusOK)
+	resp.Body.Close()
+	if got := getOrder(t, app, order.ID).Amount.Total; got != "4.01" {
+		t.Errorf("total after changing a quantity: got %s want 4.01", got)
+	}
+}
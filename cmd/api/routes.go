@@ -4,23 +4,92 @@ import (
 	"regexp"
 
 	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/auth"
 	"github.com/gofiber/fiber/v3"
 )
 
-func setupRoutes(app *fiber.App) {
-	// Define expected methods for each path pattern
-	expectedMethods := map[*regexp.Regexp][]string{
-		regexp.MustCompile(`^/api/products$`):                    {"GET"},
-		regexp.MustCompile(`^/api/orders$`):                      {"POST"},
-		regexp.MustCompile(`^/api/orders/[^/]+$`):                {"GET", "PATCH"},
-		regexp.MustCompile(`^/api/orders/[^/]+/products$`):       {"GET", "POST"},
-		regexp.MustCompile(`^/api/orders/[^/]+/products/[^/]+$`): {"PATCH"},
+// probeRoutes are the health, readiness and build information endpoints. They are
+// not rate limited and, like other routes without expected methods, not method validated.
+var probeRoutes = regexp.MustCompile(`^/(healthz|readyz|version)$`)
+
+// publicRoutes need no authentication.
+var publicRoutes = regexp.MustCompile(`^/(api/products|healthz|readyz|version)$`)
+
+// routeRoles lists the roles allowed per path pattern and method. Other routes are open to every role.
+var routeRoles = map[*regexp.Regexp]map[string][]string{
+	regexp.MustCompile(`^/api/orders/[^/]+/refunds$`):                {"POST": {auth.RoleCashier, auth.RoleAdmin}},
+	regexp.MustCompile(`^/api/orders/[^/]+/products/[^/]+/returns$`): {"POST": {auth.RoleCashier, auth.RoleAdmin}},
+	regexp.MustCompile(`^/api/admin/`):                               {"GET": {auth.RoleAdmin}},
+	regexp.MustCompile(`^/api/audit(/|$)`):                           {"GET": {auth.RoleAdmin}},
+	regexp.MustCompile(`^/api/webhooks(/|$)`): {
+		"GET": {auth.RoleAdmin}, "POST": {auth.RoleAdmin}, "PATCH": {auth.RoleAdmin}, "DELETE": {auth.RoleAdmin},
+	},
+}
+
+// Route groups that are rate limited separately.
+const (
+	groupRead  = "read"
+	groupWrite = "write"
+	groupAdmin = "admin"
+)
+
+var adminRoutes = regexp.MustCompile(`^/api/(admin|audit|webhooks)(/|$)`)
+
+// rateLimitGroup returns the route group of a request, or "" if it is not rate limited.
+func rateLimitGroup(path, method string) string {
+	switch {
+	case probeRoutes.MatchString(path):
+		return ""
+	case adminRoutes.MatchString(path):
+		return groupAdmin
+	case method == fiber.MethodGet || method == fiber.MethodHead:
+		return groupRead
+	default:
+		return groupWrite
 	}
+}
+
+// defaultCachePolicy makes clients revalidate responses, which only they may store.
+const defaultCachePolicy = "max-age=0, private, must-revalidate"
+
+// cachePolicies lists the Cache-Control header per path pattern; other routes get defaultCachePolicy.
+// The catalog rarely changes and is the same for everyone, so shared caches may serve it
+// for a minute and then revalidate it by its ETag. Probes and admin data are never stored.
+var cachePolicies = map[*regexp.Regexp]string{
+	regexp.MustCompile(`^/api/products$`): "public, max-age=60",
+	probeRoutes:                           "no-store",
+	adminRoutes:                           "no-store",
+}
 
+// expectedMethods lists the methods of each API path pattern; other methods are answered with 404.
+var expectedMethods = map[*regexp.Regexp][]string{
+	regexp.MustCompile(`^/api/products$`):                                  {"GET"},
+	regexp.MustCompile(`^/api/orders$`):                                    {"POST"},
+	regexp.MustCompile(`^/api/orders/[^/]+$`):                              {"GET", "PATCH"},
+	regexp.MustCompile(`^/api/orders/[^/]+/products$`):                     {"GET", "POST"},
+	regexp.MustCompile(`^/api/orders/[^/]+/products/[^/]+$`):               {"PATCH"},
+	regexp.MustCompile(`^/api/orders/[^/]+/payments$`):                     {"GET", "POST"},
+	regexp.MustCompile(`^/api/orders/[^/]+/refunds$`):                      {"GET", "POST"},
+	regexp.MustCompile(`^/api/orders/[^/]+/products/[^/]+/returns$`):       {"POST"},
+	regexp.MustCompile(`^/api/orders/[^/]+/products/[^/]+/replaced_with$`): {"DELETE"},
+	regexp.MustCompile(`^/api/orders/[^/]+/events$`):                       {"GET"},
+	regexp.MustCompile(`^/api/orders/[^/]+/history$`):                      {"GET"},
+	regexp.MustCompile(`^/api/admin/events$`):                              {"GET"},
+	regexp.MustCompile(`^/api/audit$`):                                     {"GET"},
+	regexp.MustCompile(`^/api/audit/verify$`):                              {"GET"},
+	regexp.MustCompile(`^/api/webhooks$`):                                  {"GET", "POST"},
+	regexp.MustCompile(`^/api/webhooks/[^/]+$`):                            {"GET", "PATCH", "DELETE"},
+	regexp.MustCompile(`^/api/webhooks/[^/]+/deliveries$`):                 {"GET"},
+}
+
+func setupRoutes(app *fiber.App) {
 	// Custom method error handler middleware
 	app.Use(methodValidationMiddleware(expectedMethods))
 
 	// Endpoint definitions
+	app.Get("/healthz", api.Healthz)
+	app.Get("/readyz", api.Readyz)
+	app.Get("/version", api.Version)
 	app.Get("/api/products", api.GetProducts)
 	app.Post("/api/orders", api.CreateOrder)
 	app.Get("/api/orders/:order_id", api.GetOrder)
@@ -28,4 +97,22 @@ func setupRoutes(app *fiber.App) {
 	app.Post("/api/orders/:order_id/products", api.AddProductsToOrder)
 	app.Get("/api/orders/:order_id/products", api.GetOrderProducts)
 	app.Patch("/api/orders/:order_id/products/:product_id", api.ProductPatchHandler)
+	app.Post("/api/orders/:order_id/payments", api.AddOrderPayment)
+	app.Get("/api/orders/:order_id/payments", api.GetOrderPayments)
+	app.Get("/api/orders/:order_id/events", api.StreamOrderEvents)
+	app.Get("/api/orders/:order_id/history", api.GetOrderHistory)
+	app.Get("/api/admin/events", api.StreamAllEvents)
+	app.Post("/api/orders/:order_id/refunds", api.AddOrderRefund)
+	app.Get("/api/orders/:order_id/refunds", api.GetOrderRefunds)
+	app.Post("/api/orders/:order_id/products/:product_id/returns", api.ReturnOrderProduct)
+	app.Delete("/api/orders/:order_id/products/:product_id/replaced_with", api.UndoReplacementProduct)
+	app.Get("/api/audit", api.GetAuditEntries)
+	app.Get("/api/audit/verify", api.VerifyAuditLog)
+	app.Get("/api/webhooks", api.GetWebhooks)
+	app.Post("/api/webhooks", api.CreateWebhook)
+	app.Get("/api/webhooks/dead-letters", api.GetWebhookDeadLetters)
+	app.Get("/api/webhooks/:webhook_id", api.GetWebhook)
+	app.Patch("/api/webhooks/:webhook_id", api.UpdateWebhook)
+	app.Delete("/api/webhooks/:webhook_id", api.DeleteWebhook)
+	app.Get("/api/webhooks/:webhook_id/deliveries", api.GetWebhookDeliveries)
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/api"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test GET /api/orders/:order_id/events - live updates and Last-Event-ID resume.
+// Not parallel: it shortens the shared stream heartbeat.
+func TestStreamOrderEvents(t *testing.T) {
+	heartbeat := api.StreamHeartbeat
+	api.StreamHeartbeat = 10 * time.Millisecond
+	defer func() { api.StreamHeartbeat = heartbeat }()
+
+	app := setupApp()
+	api.StartStreams(data.Events)
+	baseURL := serve(t, app)
+
+	order := createOrder(t, app)
+	addProduct(t, app, order.ID, "123", false)
+	path := baseURL + apiOrdersPath + "/" + order.ID + "/events"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := openStream(t, ctx, path, "")
+
+	// New clients only get the changes made after they connected.
+	addProduct(t, app, order.ID, "456", false)
+	live := <-events
+	if live.name != data.EventProductAdded || !strings.Contains(live.data, `"name":"Beer"`) {
+		t.Errorf("unexpected live event: %+v", live)
+	}
+
+	// Resuming replays the events after the Last-Event-ID.
+	resumed := openStream(t, ctx, path, "0")
+	for _, want := range []string{data.EventOrderCreated, data.EventProductAdded, data.EventProductAdded} {
+		if got := <-resumed; got.name != want {
+			t.Errorf("resumed event: got %s want %s", got.name, want)
+		}
+	}
+	addProduct(t, app, order.ID, "123", false)
+	if got := <-resumed; got.name != data.EventProductAdded || got.id == live.id {
+		t.Errorf("resumed live event: %+v after %+v", got, live)
+	}
+}
+
+type streamedEvent struct {
+	id, name, data string
+}
+
+// serve runs the app on a local port until the test ends.
+func serve(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+// openStream reads the Server-Sent Events of url into the returned channel.
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) <-chan streamedEvent {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "text/event-stream" {
+		t.Fatalf("content type: got %s", ct)
+	}
+
+	events := make(chan streamedEvent)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var ev streamedEvent
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data += strings.TrimPrefix(line, "data: ")
+			case line == "" && ev.name != "":
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+				ev = streamedEvent{}
+			}
+		}
+	}()
+	return events
+}
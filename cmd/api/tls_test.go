@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/certs/certstest"
+	"awesomeProject/pkg/config"
+)
+
+// serveTLS serves an app answering the principal of the request on a TLS listener
+// configured like the API, with client certificates verified against ca.
+func serveTLS(t *testing.T, ca *certstest.Cert, clientAuth string) string {
+	t.Helper()
+	dir := t.TempDir()
+	server := certstest.Issue(t, "localhost", ca)
+	certPEM, keyPEM := server.PEM(t)
+	caPEM, _ := ca.PEM(t)
+	cfg := config.Default()
+	cfg.TLS = config.TLS{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   clientAuth,
+		ClientRoles:  []string{"billing=admin"},
+	}
+	for path, content := range map[string][]byte{cfg.TLS.CertFile: certPEM, cfg.TLS.KeyFile: keyPEM, cfg.TLS.ClientCAFile: caPEM} {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	authenticator, err := setupAuth(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listen("127.0.0.1:0", cfg.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Use(authMiddleware(authenticator, regexp.MustCompile(`^/public$`), nil))
+	app.Get("/whoami", func(c fiber.Ctx) error {
+		p, _ := auth.PrincipalFrom(c)
+		return c.JSON(p)
+	})
+	app.Get("/public", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return "https://" + ln.Addr().String()
+}
+
+func tlsClient(t *testing.T, ca *certstest.Cert, client *certstest.Cert) *http.Client {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if client != nil {
+		// Present the certificate even if the server does not list its CA.
+		cert := client.TLSCertificate(t)
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &cert, nil }
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 5 * time.Second}
+}
+
+func TestClientCertificates(t *testing.T) {
+	ca := certstest.Issue(t, "test CA", nil)
+	url := serveTLS(t, ca, "optional")
+
+	for _, tc := range []struct {
+		name   string
+		client *certstest.Cert
+		status int
+		want   auth.Principal
+	}{
+		{name: "mapped common name", client: certstest.Issue(t, "billing", ca), status: http.StatusOK, want: auth.Principal{Method: auth.MethodClientCert, Subject: "billing", Role: auth.RoleAdmin}},
+		{name: "other common name", client: certstest.Issue(t, "kiosk", ca), status: http.StatusOK, want: auth.Principal{Method: auth.MethodClientCert, Subject: "kiosk", Role: auth.RoleCustomer}},
+		{name: "no certificate", status: http.StatusUnauthorized},
+	} {
+		resp, err := tlsClient(t, ca, tc.client).Get(url + "/whoami")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got auth.Principal
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || (tc.status == http.StatusOK && got != tc.want) {
+			t.Errorf("%s: got %d %+v, want %d %+v", tc.name, resp.StatusCode, got, tc.status, tc.want)
+		}
+	}
+
+	// Certificates of other CAs fail the handshake.
+	if _, err := tlsClient(t, ca, certstest.Issue(t, "billing", nil)).Get(url + "/whoami"); err == nil {
+		t.Error("certificate of an unknown CA accepted")
+	}
+
+	// Required client certificates fail the handshake without one, public routes included.
+	url = serveTLS(t, ca, "require")
+	if _, err := tlsClient(t, ca, nil).Get(url + "/public"); err == nil {
+		t.Error("connection without a required client certificate accepted")
+	}
+	resp, err := tlsClient(t, ca, certstest.Issue(t, "kiosk", ca)).Get(url + "/public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("public route answered %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"awesomeProject/pkg/tracing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+)
+
+// exportedSpans is the part of an OTLP JSON line written by the trace exporter the tests check.
+type exportedSpans struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []exportedSpan
+		}
+	}
+}
+
+type exportedSpan struct {
+	Name         string
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Attributes   []struct {
+		Key   string
+		Value struct{ StringValue string }
+	}
+}
+
+// Test that requests continue the incoming trace and store operations are child spans.
+func TestTracing(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	exporter, err := tracing.NewWriterExporter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	provider := tracing.NewProvider("test", exporter)
+	app.Use(requestid.New(), tracingMiddleware(tracing.Tracer(provider)))
+	registerHandlers(app)
+
+	order := createOrder(t, app)
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(fiber.MethodPost, apiOrdersPath+"/"+order.ID+"/products", strings.NewReader("[123]"))
+	req.Header.Set("traceparent", traceparent)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	checkStatusCode(t, resp, http.StatusCreated)
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]exportedSpan{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var exported exportedSpans
+		if err := json.Unmarshal([]byte(line), &exported); err != nil {
+			t.Fatal(err)
+		}
+		for _, rs := range exported.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+
+	server, ok := spans["POST /api/orders/:order_id/products"]
+	if !ok || server.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected server span: %+v", spans)
+	}
+	if got := resp.Header.Get("traceresponse"); !strings.Contains(got, server.SpanID) {
+		t.Errorf("traceresponse: got %q, want span %s", got, server.SpanID)
+	}
+	hasRequestID := false
+	for _, a := range server.Attributes {
+		hasRequestID = hasRequestID || (a.Key == "request.id" && a.Value.StringValue != "")
+	}
+	if !hasRequestID {
+		t.Error("server span without request.id")
+	}
+	for _, name := range []string{"store.load_order", "order.calculate_total", "store.save_order"} {
+		if span := spans[name]; span.ParentSpanID != server.SpanID {
+			t.Errorf("%s is not a child of the server span: %+v", name, span)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"awesomeProject/pkg/webhooks"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Test the /api/webhooks subscription CRUD endpoints.
+func TestWebhookSubscriptions(t *testing.T) {
+	t.Parallel()
+	app := setupApp()
+
+	for _, body := range []string{
+		`{"url": "ftp://example.com"}`,
+		`{"url": "https://example.com/hook", "events": ["order.unknown"]}`,
+	} {
+		resp := performRequestAndCheckStatus(t, app, fiber.MethodPost, "/api/webhooks", bytes.NewBufferString(body), http.StatusBadRequest)
+		resp.Body.Close()
+	}
+
+	resp := performRequestAndCheckStatus(t, app, fiber.MethodPost, "/api/webhooks",
+		bytes.NewBufferString(`{"url": "https://example.com/hook", "events": ["order.paid"]}`), http.StatusCreated)
+	var created webhooks.Subscription
+	unmarshalResponseBody(t, resp, &created)
+	resp.Body.Close()
+	if created.Secret == "" || !created.Active {
+		t.Errorf("unexpected subscription: %+v", created)
+	}
+
+	path := "/api/webhooks/" + created.ID
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodPatch, path, bytes.NewBufferString(`{"active": false}`), http.StatusOK)
+	var updated webhooks.Subscription
+	unmarshalResponseBody(t, resp, &updated)
+	resp.Body.Close()
+	if updated.Active || updated.Secret != "" || updated.URL != created.URL {
+		t.Errorf("unexpected updated subscription: %+v", updated)
+	}
+
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, path+"/deliveries", nil, http.StatusOK)
+	resp.Body.Close()
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodDelete, path, nil, http.StatusOK)
+	resp.Body.Close()
+	resp = performRequestAndCheckStatus(t, app, fiber.MethodGet, path, nil, http.StatusNotFound)
+	resp.Body.Close()
+}
@@ -0,0 +1,36 @@
+// Command auditverify checks the hash chain of an audit log file written by
+// the API (see the --audit-log flag):
+//
+//	go run ./cmd/auditverify audit.log
+//
+// It exits with status 1 if an entry was changed, removed or inserted. Entries
+// removed from the end cannot be detected from the file alone, so compare the
+// printed last hash with one recorded elsewhere.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"awesomeProject/pkg/audit"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: auditverify <audit log file>")
+		os.Exit(2)
+	}
+
+	count, lastHash, err := audit.VerifyFile(os.Args[1])
+	if errors.As(err, new(*fs.PathError)) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit log is NOT valid: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("audit log is valid: %d entries, last hash %s\n", count, lastHash)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"awesomeProject/pkg/audit"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// AuditLog records every state-changing request.
+var AuditLog = audit.NewLog()
+
+// Default and maximum number of audit entries returned per request.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GetAuditEntries retrieves a page of audit entries filtered by the order_id,
+// actor, from and to (RFC 3339 timestamps) query parameters. The page starts
+// after the sequence number in after and holds at most limit entries.
+func GetAuditEntries(c fiber.Ctx) error {
+	filter := audit.Filter{OrderID: c.Query("order_id"), Actor: c.Query("actor")}
+	limit := defaultAuditLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditLimit {
+			return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+		}
+		limit = parsed
+	}
+	if value := c.Query("after"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+		}
+		filter.After = parsed
+	}
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+			}
+			*t = parsed
+		}
+	}
+
+	entries, err := AuditLog.Entries(filter, limit)
+	if err != nil {
+		return internalError(c, err)
+	}
+	if len(entries) == 0 {
+		return c.JSON([]audit.Entry{})
+	}
+	return c.JSON(entries)
+}
+
+// VerifyAuditLog checks the hash chain of the audit log.
+func VerifyAuditLog(c fiber.Ctx) error {
+	if err := AuditLog.Verify(); err != nil {
+		return c.JSON(fiber.Map{"valid": false, "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"valid": true})
+}
+
+// auditChangeKey holds the orderChange of a request in its locals.
+const auditChangeKey = "audit.change"
+
+// orderChange is the order before the first and after the last save of a request.
+type orderChange struct {
+	before *data.Order
+	after  data.Order
+}
+
+// recordChange remembers a saved order for the audit log, together with the
+// stored order the first save of the request replaced.
+func recordChange(c fiber.Ctx, before *data.Order, after data.Order) {
+	change, ok := c.Locals(auditChangeKey).(*orderChange)
+	if !ok || change.after.ID != after.ID {
+		change = &orderChange{before: before}
+		c.Locals(auditChangeKey, change)
+	}
+	change.after = after.Clone()
+}
+
+// storedOrder returns the stored order, nil if there is none.
+func storedOrder(orderID string) *data.Order {
+	value, ok := data.Orders.Load(orderID)
+	if !ok {
+		return nil
+	}
+	order := value.(data.Order)
+	return &order
+}
+
+// SavedOrder returns the order a request saved as it was before and after the
+// request. Before is nil for a created order; ok is false if nothing was saved.
+func SavedOrder(c fiber.Ctx) (before, after *data.Order, ok bool) {
+	change, ok := c.Locals(auditChangeKey).(*orderChange)
+	if !ok {
+		return nil, nil, false
+	}
+	return change.before, &change.after, true
+}
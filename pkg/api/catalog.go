@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/util"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// catalogJSON caches the JSON of the catalog and its entity tag for a catalog version.
+var catalogJSON struct {
+	sync.Mutex
+	version uint64
+	body    []byte
+	etag    string
+}
+
+// catalogRepresentation returns the JSON of the catalog, its strong entity tag
+// and the time the catalog last changed. The entity tag is a hash of the JSON,
+// so it is the same on every instance serving the catalog.
+func catalogRepresentation() ([]byte, string, time.Time, error) {
+	products, version, modified := data.VersionedProducts()
+
+	catalogJSON.Lock()
+	defer catalogJSON.Unlock()
+	if catalogJSON.body == nil || catalogJSON.version != version {
+		body, err := json.Marshal(products)
+		if err != nil {
+			return nil, "", time.Time{}, err
+		}
+		sum := sha256.Sum256(body)
+		catalogJSON.version, catalogJSON.body, catalogJSON.etag = version, body, `"`+hex.EncodeToString(sum[:16])+`"`
+	}
+	return catalogJSON.body, catalogJSON.etag, modified, nil
+}
+
+// notModified reports whether the client already has the representation, as in
+// RFC 9110: If-None-Match is compared weakly and takes precedence over If-Modified-Since.
+func notModified(c fiber.Ctx, etag string, modified time.Time) bool {
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		return false
+	}
+	if noneMatch := c.Get(fiber.HeaderIfNoneMatch); noneMatch != "" {
+		for _, tag := range strings.Split(noneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince))
+	return err == nil && !modified.IsZero() && !modified.Truncate(time.Second).After(since)
+}
+
+// ReplaceCatalog replaces the catalog with the products of the request.
+func ReplaceCatalog(c fiber.Ctx) error {
+	var products []data.Product
+	if err := util.DecodeJSONBody(c, &products); err != nil || len(products) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+	if err := data.SetProducts(products); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	RequestLogger(c).Info("catalog replaced", "products", len(products))
+	return c.JSON(data.Products())
+}
+
+// PutCatalogProduct adds a product to the catalog or changes it.
+// Lines already in orders keep their name and price.
+func PutCatalogProduct(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("product_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+	var product data.Product
+	if err := util.DecodeJSONBody(c, &product); err != nil || (product.ID != 0 && product.ID != id) {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+	product.ID = id
+
+	created, err := data.PutProduct(product)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	RequestLogger(c).Info("catalog product saved", "product_id", id, "created", created)
+	if created {
+		return c.Status(fiber.StatusCreated).JSON(product)
+	}
+	return c.JSON(product)
+}
+
+// DeleteCatalogProduct removes a product from the catalog. It can no longer be
+// added to orders; lines already in orders stay.
+func DeleteCatalogProduct(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("product_id"))
+	if err != nil || !data.DeleteProduct(id) {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+
+	RequestLogger(c).Info("catalog product deleted", "product_id", id)
+	return c.Status(fiber.StatusOK).JSON("OK")
+}
@@ -2,20 +2,39 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
 
 	"awesomeProject/pkg/util"
 
+	"awesomeProject/pkg/auth"
 	"awesomeProject/pkg/data"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
 )
 
-const PAID = "PAID"
+const PAID = data.StatusPaid
 
-// GetProducts retrieves all products.
+// GetProducts retrieves all products. The catalog has a strong entity tag and,
+// if it is known, a modification time; conditional requests for the catalog the client already
+// has are answered with 304.
 func GetProducts(c fiber.Ctx) error {
-	return c.JSON(data.Products)
+	body, etag, modified, err := catalogRepresentation()
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderETag, etag)
+	if !modified.IsZero() {
+		c.Set(fiber.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c, etag, modified) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
 }
 
 func CreateOrder(c fiber.Ctx) error {
@@ -23,46 +42,114 @@ func CreateOrder(c fiber.Ctx) error {
 	orderID := oID.String()
 
 	order := data.NewOrder(orderID)
-	data.Orders.Store(orderID, order)
+	if p, ok := auth.PrincipalFrom(c); ok {
+		order.Owner = p.Owner()
+	}
+	saveOrder(c, order)
 
 	return c.Status(fiber.StatusCreated).JSON(order)
 }
 
+// GetOrder retrieves an order, or with ?as_of=<RFC 3339 timestamp> the order as it was at that time.
 func GetOrder(c fiber.Ctx) error {
 	orderID := c.Params("order_id")
-	order, ok := util.LoadOrder(orderID)
+	if asOf := c.Query("as_of"); asOf != "" {
+		at, err := time.Parse(time.RFC3339Nano, asOf)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+		}
+		order, ok := data.OrderAsOf(orderID, at)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON("Not Found")
+		}
+		return c.JSON(order)
+	}
+
+	order, ok := loadOrder(c, orderID)
 	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
 	return c.JSON(order)
 }
 
+// GetOrderHistory retrieves the stored changes of an order, oldest first.
+func GetOrderHistory(c fiber.Ctx) error {
+	history, ok := data.OrderHistory(c.Params("order_id"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	return c.JSON(history)
+}
+
 // UpdateOrderStatus updates the status of an existing order.
+// The body is either {"status": ...} or a merge patch / JSON patch changing /status.
 func UpdateOrderStatus(c fiber.Ctx) error {
 	orderID := c.Params("order_id")
 	var request data.UpdateOrderStatusRequest
-	if err := util.DecodeJSONBody(c, &request); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	isPatch := patchMediaType(c) == MIMEMergePatch || patchMediaType(c) == MIMEJSONPatch
+	if !isPatch {
+		if err := util.DecodeJSONBody(c, &request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+		}
 	}
 
-	if request.Status != "NEW" && request.Status != PAID {
-		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
-	}
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
 
-	order, ok := util.LoadOrder(orderID)
+	order, ok := loadOrder(c, orderID)
 	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
+
+	if isPatch {
+		status, err := parseOrderPatch(c, order)
+		if err != nil {
+			return patchError(c, err)
+		}
+		request.Status = status
+	}
+
+	if request.Status == PAID && !auth.Allowed(c, auth.RoleCashier, auth.RoleAdmin) {
+		return auth.Error(c, fiber.StatusForbidden)
+	}
+
+	if request.Status != data.StatusNew && request.Status != PAID {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
 
 	if order.Status == request.Status || order.Status == PAID {
 		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
 	}
 
-	order.Status = request.Status
-	if request.Status == PAID {
-		order.Amount.Paid = order.Amount.Total
+	if outstanding := data.OutstandingCents(order); request.Status == PAID && outstanding > 0 {
+		// The order only becomes PAID once the remaining balance is captured by the provider.
+		p := data.Payment{Amount: data.FormatCents(outstanding), Method: data.PaymentMethodManual}
+		captureID, err := capturePayment(c, orderID, p)
+		if err != nil {
+			return paymentError(c, err)
+		}
+		p.ProviderRef = captureID
+		// The order may only become PAID if the capture still covers it.
+		_, err = recordPayment(c, order, p, func(order *data.Order) error {
+			if data.OutstandingCents(*order) > 0 {
+				return data.ErrInvalidAmount
+			}
+			data.SetStatus(order, PAID)
+			return nil
+		})
+		if err != nil {
+			return recordPaymentError(c, err)
+		}
+		return c.Status(fiber.StatusOK).JSON("OK")
+	}
+	data.SetStatus(&order, request.Status)
+	if err := saveOrderIfUnchanged(c, order); err != nil {
+		return orderChanged(c)
 	}
-	data.Orders.Store(orderID, order)
 
 	return c.Status(fiber.StatusOK).JSON("OK")
 }
@@ -78,10 +165,17 @@ func AddProductsToOrder(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
 	}
 
-	order, ok := util.LoadOrder(orderID)
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
 	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
 
 	for _, id := range productIDs {
 		found := false
@@ -90,41 +184,43 @@ func AddProductsToOrder(c fiber.Ctx) error {
 				// Product already exists, increment its quantity by 1
 				product.Quantity++
 				order.Products[i] = product
+				order.Record(data.ProductAdded{OrderID: orderID, Product: product})
 				found = true
 				break
 			}
 		}
 
 		if !found {
-			// If product not found, find it in the global products list and add to order
-			for _, globalProduct := range data.Products {
-				if globalProduct.ID == id {
-					id := uuid.New().String()
-					order.Products = append(order.Products, data.OrderProduct{
-						ID:           id,
-						ProductID:    globalProduct.ID,
-						Name:         globalProduct.Name,
-						Price:        globalProduct.Price,
-						Quantity:     1,
-						ReplacedWith: nil,
-					})
-					break
+			// If product not found, find it in the catalog and add to order
+			if globalProduct, ok := data.FindProduct(id); ok {
+				id := uuid.New().String()
+				product := data.OrderProduct{
+					ID:           id,
+					ProductID:    globalProduct.ID,
+					Name:         globalProduct.Name,
+					Price:        globalProduct.Price,
+					Quantity:     1,
+					ReplacedWith: nil,
 				}
+				order.Products = append(order.Products, product)
+				order.Record(data.ProductAdded{OrderID: orderID, Product: product})
 			}
 		}
 	}
 
 	// Update the Total field in the Amount struct
-	order.Amount.Total = util.CalculateTotal(order.Products)
+	order.Amount.Total = calculateTotal(c.UserContext(), order.Products)
 
-	data.Orders.Store(orderID, order)
+	if err := saveOrderIfUnchanged(c, order); err != nil {
+		return orderChanged(c)
+	}
 	return c.Status(fiber.StatusCreated).JSON("OK")
 }
 
 // GetOrderProducts retrieves the products of an order.
 func GetOrderProducts(c fiber.Ctx) error {
 	orderID := c.Params("order_id")
-	order, ok := util.LoadOrder(orderID)
+	order, ok := loadOrder(c, orderID)
 	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
@@ -145,28 +241,30 @@ func UpdateProductQuantity(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
 	}
 
-	order, ok := util.LoadOrder(orderID)
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
 	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
 
-	// Validate the status of order
-	if order.Status == PAID {
+	err := setProductQuantity(c.UserContext(), &order, productID, request.Quantity)
+	switch {
+	case errors.Is(err, data.ErrOrderPaid):
 		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	case err != nil:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not Found"})
 	}
-
-	for i, product := range order.Products {
-		if product.ID == productID {
-			// Update the product's quantity
-			order.Products[i].Quantity = request.Quantity
-			// Recalculate the total amount of the order
-			order.Amount.Total = util.CalculateTotal(order.Products)
-			data.Orders.Store(orderID, order)
-			return c.Status(fiber.StatusOK).JSON("OK")
-		}
+	if err := saveOrderIfUnchanged(c, order); err != nil {
+		return orderChanged(c)
 	}
 
-	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not Found"})
+	return c.Status(fiber.StatusOK).JSON("OK")
 }
 
 func AddReplacementProduct(c fiber.Ctx) error {
@@ -189,25 +287,96 @@ func AddReplacementProduct(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
 	}
 
-	order, ok := util.LoadOrder(orderID)
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
 	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
+	if !lineChangeAllowed(c, order) {
+		return auth.Error(c, fiber.StatusForbidden)
+	}
+
+	refund, err := data.ReplaceProduct(&order, productID, request.ReplacedWith.ProductID, request.ReplacedWith.Quantity)
+	switch {
+	case errors.Is(err, data.ErrProductNotFound), errors.Is(err, data.ErrCatalogProductNotFound):
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	var refunds []data.Refund
+	if refund != nil {
+		refunds = append(refunds, *refund)
+	}
+	if _, err := saveAndIssueRefunds(c, order, refunds...); err != nil {
+		return saveError(c, err)
+	}
 
-	// Ensure all calculations and updates to the order's financial data are done within this critical section.
-	oldTotal := order.Amount.Total
-	newTotal, found := data.UpdateProduct(&order, productID, request.ReplacedWith.ProductID, request.ReplacedWith.Quantity)
+	return c.Status(fiber.StatusOK).JSON("OK")
+}
 
-	if !found {
+// UndoReplacementProduct removes the last replacement of an order product.
+func UndoReplacementProduct(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	productID := c.Params("product_id")
+
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
+	if !ok {
 		return c.Status(fiber.StatusNotFound).JSON("Not Found")
 	}
-	data.UpdateOrderAmount(&order, oldTotal, newTotal)
-	data.Orders.Store(orderID, order)
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
+	if !lineChangeAllowed(c, order) {
+		return auth.Error(c, fiber.StatusForbidden)
+	}
+
+	err := data.UndoReplacement(&order, productID)
+	switch {
+	case errors.Is(err, data.ErrProductNotFound), errors.Is(err, data.ErrNoReplacement):
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	case errors.Is(err, data.ErrRefundIssued):
+		return c.Status(fiber.StatusConflict).JSON("Refund already issued")
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+	if err := saveOrderIfUnchanged(c, order); err != nil {
+		return orderChanged(c)
+	}
 
 	return c.Status(fiber.StatusOK).JSON("OK")
 }
 
+// orderChanged answers a request whose change could not be saved because the
+// order changed since it was loaded.
+func orderChanged(c fiber.Ctx) error {
+	return c.Status(fiber.StatusConflict).JSON("Order changed")
+}
+
+// lineChangeAllowed reports whether the caller may change the lines of the order.
+// Changes of PAID orders create or revert refunds, so only cashiers and admins may make them.
+func lineChangeAllowed(c fiber.Ctx, order data.Order) bool {
+	return order.Status != PAID || auth.Allowed(c, auth.RoleCashier, auth.RoleAdmin)
+}
+
+// ProductPatchHandler dispatches PATCH requests of an order line. Merge patches and
+// JSON patches may combine several changes; a plain JSON body performs a single action.
 func ProductPatchHandler(c fiber.Ctx) error {
+	switch patchMediaType(c) {
+	case MIMEMergePatch, MIMEJSONPatch:
+		return PatchOrderProduct(c)
+	}
+
 	var body map[string]interface{}
 	if err := json.Unmarshal(c.Body(), &body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"sync/atomic"
+	"time"
+
+	"awesomeProject/pkg/buildinfo"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// storeCheckTimeout bounds the readiness check of the order store.
+const storeCheckTimeout = time.Second
+
+var shuttingDown atomic.Bool
+
+// SetShuttingDown marks the server as shutting down, which fails the readiness probe,
+// or clears the mark again.
+func SetShuttingDown(down bool) {
+	shuttingDown.Store(down)
+}
+
+// Healthz reports that the process is alive.
+func Healthz(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Readyz reports whether the server can take traffic: the order store answers,
+// the catalog is loaded and the server is not shutting down.
+func Readyz(c fiber.Ctx) error {
+	checks := fiber.Map{"store": "ok", "catalog": "ok", "shutdown": "ok"}
+	ready := true
+
+	done := make(chan struct{})
+	go func() {
+		data.StoreSize()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(storeCheckTimeout):
+		checks["store"], ready = "unavailable", false
+	}
+	if len(data.Products()) == 0 {
+		checks["catalog"], ready = "not loaded", false
+	}
+	if shuttingDown.Load() {
+		checks["shutdown"], ready = "shutting down", false
+	}
+
+	if !ready {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "not ready", "checks": checks})
+	}
+	return c.JSON(fiber.Map{"status": "ready", "checks": checks})
+}
+
+// Version returns the build information of the server.
+func Version(c fiber.Ctx) error {
+	return c.JSON(buildinfo.Get())
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"log/slog"
+	"regexp"
+
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Logger is the base logger of request logs. Replace it before serving requests.
+var Logger = slog.Default()
+
+var orderPathPattern = regexp.MustCompile(`^/api/orders/([^/]+)`)
+
+// RequestLogger returns a logger with the request ID, route, order ID and trace ID of the request.
+func RequestLogger(c fiber.Ctx) *slog.Logger {
+	return requestLogger(c, "")
+}
+
+// requestLogger is RequestLogger for the given order, which defaults to the order of the path.
+func requestLogger(c fiber.Ctx, orderID string) *slog.Logger {
+	attrs := []any{slog.String("request_id", requestid.FromContext(c)), slog.String("route", c.Route().Path)}
+	if m := orderPathPattern.FindStringSubmatch(c.Path()); orderID == "" && m != nil {
+		orderID = m[1]
+	}
+	if orderID != "" {
+		attrs = append(attrs, slog.String("order_id", orderID))
+	}
+	if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+	}
+	return Logger.With(attrs...)
+}
+
+// logOrderEvents logs the business events of a change of the order.
+func logOrderEvents(c fiber.Ctx, order data.Order) {
+	log := requestLogger(c, order.ID)
+	for _, ev := range order.Recorded() {
+		switch e := ev.(type) {
+		case data.OrderStatusChanged:
+			log.Info("order status changed", "from", e.From, "to", e.To)
+		case data.ProductReplaced:
+			log.Info("product replaced", "line_id", e.LineID, "product_id", e.Replacement.ProductID,
+				"quantity", e.Replacement.Quantity, "discount", e.Replacement.Discount, "returns", e.Replacement.Returns)
+		case data.ReplacementUndone:
+			log.Info("replacement undone", "line_id", e.LineID, "product_id", e.Replacement.ProductID)
+		default:
+			log.Debug("order event", "event", ev.Name())
+		}
+	}
+}
+
+// internalError logs an unexpected error and responds with 500.
+func internalError(c fiber.Ctx, err error) error {
+	RequestLogger(c).Error("request failed", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON("Internal Server Error")
+}
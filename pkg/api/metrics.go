@@ -0,0 +1,155 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/events"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the request and business metrics exposed on /metrics.
+var Metrics = prometheus.NewRegistry()
+
+var (
+	metrics = promauto.With(Metrics)
+
+	requestsTotal = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route template, method and status.",
+	}, []string{"route", "method", "status"})
+	requestDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	productsAdded = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "orders_products_added_total",
+		Help: "Products added to orders.",
+	})
+	replacements = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_replacements_total",
+		Help: "Product replacements by kind: discount (more expensive item), return (cheaper item) or even.",
+	}, []string{"kind"})
+	ordersPaid = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "orders_paid_total",
+		Help: "Orders that became PAID.",
+	})
+	paidAmount = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "orders_paid_amount_total",
+		Help: "Sum of the totals of the orders that became PAID.",
+	})
+	ordersExpired = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "orders_expired_total",
+		Help: "NEW orders expired by the janitor.",
+	})
+	ordersPurged = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "orders_purged_total",
+		Help: "Expired orders purged by the janitor.",
+	})
+
+	startMetrics sync.Once
+)
+
+func init() {
+	const droppedHelp = "Order events dropped because the queue of an event stream subscriber or a webhook subscription was full."
+	metrics.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "events_dropped_total",
+		Help:        droppedHelp,
+		ConstLabels: prometheus.Labels{"queue": "subscriber"},
+	}, func() float64 { return float64(data.Events.Dropped()) })
+	metrics.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "events_dropped_total",
+		Help:        droppedHelp,
+		ConstLabels: prometheus.Labels{"queue": "webhook"},
+	}, func() float64 { return float64(Webhooks.Dropped()) })
+	Metrics.MustRegister(storeCollector{})
+}
+
+var (
+	ordersDesc        = prometheus.NewDesc("orders", "Stored orders by status.", []string{"status"}, nil)
+	storeSizeDesc     = prometheus.NewDesc("orders_store_size", "Stored orders.", nil, nil)
+	historyEventsDesc = prometheus.NewDesc("orders_history_events", "Stored history events of all orders.", nil, nil)
+)
+
+// storeCollector reports the contents of the order store when it is scraped.
+type storeCollector struct{}
+
+func (storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ordersDesc
+	ch <- storeSizeDesc
+	ch <- historyEventsDesc
+}
+
+func (storeCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[string]int{data.StatusNew: 0, data.StatusPaid: 0, data.StatusExpired: 0}
+	data.Orders.Range(func(_, value any) bool {
+		counts[value.(data.Order).Status]++
+		return true
+	})
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(ordersDesc, prometheus.GaugeValue, float64(count), status)
+	}
+	orders, events := data.StoreSize()
+	ch <- prometheus.MustNewConstMetric(storeSizeDesc, prometheus.GaugeValue, float64(orders))
+	ch <- prometheus.MustNewConstMetric(historyEventsDesc, prometheus.GaugeValue, float64(events))
+}
+
+// StartMetrics counts the business events published on the bus.
+func StartMetrics(bus *events.Bus) {
+	startMetrics.Do(func() {
+		bus.Subscribe(countEvent)
+	})
+}
+
+func countEvent(env events.Envelope) {
+	switch e := env.Event.(type) {
+	case data.ProductAdded:
+		productsAdded.Inc()
+	case data.ProductReplaced:
+		switch {
+		case e.Replacement.Discount != "0.00":
+			replacements.WithLabelValues("discount").Inc()
+		case e.Replacement.Returns != "0.00":
+			replacements.WithLabelValues("return").Inc()
+		default:
+			replacements.WithLabelValues("even").Inc()
+		}
+	case data.OrderPaid:
+		ordersPaid.Inc()
+		if total, err := strconv.ParseFloat(e.Amount.Total, 64); err == nil && total > 0 {
+			paidAmount.Add(total)
+		}
+	case data.OrderExpired:
+		ordersExpired.Inc()
+	}
+}
+
+// ObserveRequest counts a handled request.
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	// The labels are kept, callers may pass strings backed by reused buffers.
+	route, method = strings.Clone(route), strings.Clone(method)
+	requestsTotal.WithLabelValues(route, method, code).Inc()
+	requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// ObservePurged counts orders purged by the janitor.
+func ObservePurged(purged int) {
+	ordersPurged.Add(float64(purged))
+}
+
+var metricsHandler = adaptor.HTTPHandler(promhttp.HandlerFor(Metrics, promhttp.HandlerOpts{}))
+
+// GetMetrics writes the metrics in the Prometheus exposition format the client accepts.
+func GetMetrics(c fiber.Ctx) error {
+	return metricsHandler(c)
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/data"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Patch media types accepted by the PATCH endpoints, besides the plain JSON bodies.
+const (
+	MIMEMergePatch = "application/merge-patch+json" // RFC 7386
+	MIMEJSONPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+var (
+	errInvalidPatch    = errors.New("invalid patch")
+	errPatchTestFailed = errors.New("patch test operation failed")
+)
+
+// jsonPatchOp is a single RFC 6902 operation.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type replacementPatch struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// lineOp is a single validated change to an order line. Exactly one field is set.
+type lineOp struct {
+	quantity    *int
+	replacement *replacementPatch
+	undo        bool
+	test        *jsonPatchOp
+}
+
+// patchMediaType returns the media type of the request body without parameters.
+func patchMediaType(c fiber.Ctx) string {
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	return mediaType
+}
+
+// PatchOrderProduct applies a merge patch or JSON patch to an order line.
+// All operations are applied to a copy of the order, which is only stored when every one succeeds.
+func PatchOrderProduct(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	productID := c.Params("product_id")
+
+	var ops []lineOp
+	var err error
+	if patchMediaType(c) == MIMEJSONPatch {
+		ops, err = parseLineJSONPatch(c.Body())
+	} else {
+		ops, err = parseLineMergePatch(c.Body())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
+	if !lineChangeAllowed(c, order) {
+		return auth.Error(c, fiber.StatusForbidden)
+	}
+
+	refunds, err := applyLineOps(c.UserContext(), &order, productID, ops)
+	if err != nil {
+		return patchError(c, err)
+	}
+	if _, err := saveAndIssueRefunds(c, order, refunds...); err != nil {
+		return saveError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON("OK")
+}
+
+// parseLineMergePatch accepts "quantity" and "replaced_with" members.
+// A null "replaced_with" undoes the last replacement.
+func parseLineMergePatch(body []byte) ([]lineOp, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || len(patch) == 0 {
+		return nil, errInvalidPatch
+	}
+
+	var ops []lineOp
+	// The quantity goes first, so a replacement in the same patch replaces the new quantity.
+	if raw, ok := patch["quantity"]; ok {
+		op, err := quantityOp(raw)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+		delete(patch, "quantity")
+	}
+	if raw, ok := patch["replaced_with"]; ok {
+		op, err := replacementOp(raw)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+		delete(patch, "replaced_with")
+	}
+	if len(patch) > 0 {
+		return nil, errInvalidPatch
+	}
+	return ops, nil
+}
+
+// parseLineJSONPatch accepts replace/add of /quantity and /replaced_with,
+// remove of /replaced_with and test of any path.
+func parseLineJSONPatch(body []byte) ([]lineOp, error) {
+	var patch []jsonPatchOp
+	if err := json.Unmarshal(body, &patch); err != nil || len(patch) == 0 {
+		return nil, errInvalidPatch
+	}
+
+	ops := make([]lineOp, 0, len(patch))
+	for _, p := range patch {
+		var op lineOp
+		var err error
+		switch {
+		case p.Op == "test":
+			op = lineOp{test: &p}
+		case (p.Op == "replace" || p.Op == "add") && p.Path == "/quantity":
+			op, err = quantityOp(p.Value)
+		case (p.Op == "replace" || p.Op == "add") && p.Path == "/replaced_with":
+			op, err = replacementOp(p.Value)
+		case p.Op == "remove" && p.Path == "/replaced_with":
+			op = lineOp{undo: true}
+		default:
+			err = errInvalidPatch
+		}
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func quantityOp(raw json.RawMessage) (lineOp, error) {
+	var quantity int
+	if err := json.Unmarshal(raw, &quantity); err != nil || quantity < 1 {
+		return lineOp{}, errInvalidPatch
+	}
+	return lineOp{quantity: &quantity}, nil
+}
+
+func replacementOp(raw json.RawMessage) (lineOp, error) {
+	if string(raw) == "null" {
+		return lineOp{undo: true}, nil
+	}
+	var replacement replacementPatch
+	if err := json.Unmarshal(raw, &replacement); err != nil || replacement.Quantity < 1 {
+		return lineOp{}, errInvalidPatch
+	}
+	return lineOp{replacement: &replacement}, nil
+}
+
+// applyLineOps applies the operations in order and returns the refunds to be issued.
+func applyLineOps(ctx context.Context, order *data.Order, lineID string, ops []lineOp) ([]data.Refund, error) {
+	var refunds []data.Refund
+	for _, op := range ops {
+		switch {
+		case op.quantity != nil:
+			if err := setProductQuantity(ctx, order, lineID, *op.quantity); err != nil {
+				return nil, err
+			}
+		case op.replacement != nil:
+			refund, err := data.ReplaceProduct(order, lineID, op.replacement.ProductID, op.replacement.Quantity)
+			if err != nil {
+				return nil, err
+			}
+			if refund != nil {
+				refunds = append(refunds, *refund)
+			}
+		case op.undo:
+			if err := data.UndoReplacement(order, lineID); err != nil {
+				return nil, err
+			}
+		case op.test != nil:
+			i := slices.IndexFunc(order.Products, func(p data.OrderProduct) bool { return p.ID == lineID })
+			if i < 0 {
+				return nil, data.ErrProductNotFound
+			}
+			if err := testPatch(order.Products[i], *op.test); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return refunds, nil
+}
+
+// setProductQuantity changes the quantity of an unpaid order line and recalculates the total.
+func setProductQuantity(ctx context.Context, order *data.Order, lineID string, quantity int) error {
+	if order.Status == PAID {
+		return data.ErrOrderPaid
+	}
+	for i, product := range order.Products {
+		if product.ID == lineID {
+			order.Products[i].Quantity = quantity
+			order.Amount.Total = calculateTotal(ctx, order.Products)
+			order.Record(data.ProductQuantityChanged{OrderID: order.ID, LineID: lineID, Quantity: quantity})
+			return nil
+		}
+	}
+	return data.ErrProductNotFound
+}
+
+// testPatch evaluates a JSON patch "test" operation against the JSON form of doc.
+func testPatch(doc any, op jsonPatchOp) error {
+	var want any
+	if err := json.Unmarshal(op.Value, &want); err != nil {
+		return errInvalidPatch
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var current any
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return err
+	}
+
+	got, ok := resolvePointer(current, op.Path)
+	if !ok || !reflect.DeepEqual(got, want) {
+		return errPatchTestFailed
+	}
+	return nil
+}
+
+// resolvePointer resolves an RFC 6901 JSON pointer in a decoded JSON document.
+func resolvePointer(doc any, pointer string) (any, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// parseOrderPatch returns the status requested by a merge patch or JSON patch of an order.
+// Test operations are evaluated against the order as patched so far.
+func parseOrderPatch(c fiber.Ctx, order data.Order) (string, error) {
+	if patchMediaType(c) != MIMEJSONPatch {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal(c.Body(), &patch); err != nil || len(patch) != 1 {
+			return "", errInvalidPatch
+		}
+		var status string
+		if err := json.Unmarshal(patch["status"], &status); err != nil {
+			return "", errInvalidPatch
+		}
+		return status, nil
+	}
+
+	var patch []jsonPatchOp
+	if err := json.Unmarshal(c.Body(), &patch); err != nil || len(patch) == 0 {
+		return "", errInvalidPatch
+	}
+	status := ""
+	for _, op := range patch {
+		switch {
+		case op.Op == "test":
+			if err := testPatch(order, op); err != nil {
+				return "", err
+			}
+		case (op.Op == "replace" || op.Op == "add") && op.Path == "/status":
+			if err := json.Unmarshal(op.Value, &status); err != nil {
+				return "", errInvalidPatch
+			}
+			order.Status = status
+		default:
+			return "", errInvalidPatch
+		}
+	}
+	if status == "" {
+		return "", errInvalidPatch
+	}
+	return status, nil
+}
+
+// patchError maps an error of a patch operation to a response.
+func patchError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errPatchTestFailed):
+		return c.Status(fiber.StatusConflict).JSON("Test failed")
+	case errors.Is(err, data.ErrRefundIssued):
+		return c.Status(fiber.StatusConflict).JSON("Refund already issued")
+	case errors.Is(err, data.ErrProductNotFound), errors.Is(err, data.ErrCatalogProductNotFound),
+		errors.Is(err, data.ErrNoReplacement):
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	case errors.Is(err, data.ErrOrderPaid):
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/payment"
+	"awesomeProject/pkg/util"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+var (
+	// PaymentProvider handles every non-cash payment. Replace it before serving requests.
+	PaymentProvider payment.Provider = payment.NewFake()
+	// ProviderTimeout bounds each call to the PaymentProvider.
+	ProviderTimeout = 10 * time.Second
+	// saveAttempts bounds how often a captured payment is recorded on an order that
+	// keeps changing before the capture is refunded.
+	saveAttempts = 3
+)
+
+// orderLocks serialize the changes of each order: handlers hold the lock of the
+// order from loading it until it is saved, including the payment provider calls, so
+// that concurrent requests cannot both pass CheckPayment and capture the
+// outstanding amount or overwrite each other's changes. The janitor and refund
+// retries change orders without it, so handlers still save with saveOrderIfUnchanged.
+var orderLocks [64]sync.Mutex
+
+func orderLock(orderID string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(orderID))
+	return &orderLocks[h.Sum32()%uint32(len(orderLocks))]
+}
+
+// AddOrderPayment records a (possibly partial) payment towards an order.
+func AddOrderPayment(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	var request data.AddPaymentRequest
+	if err := util.DecodeJSONBody(c, &request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	// Payments without a provider are taken at the till.
+	if request.Method == data.PaymentMethodCash || request.Method == data.PaymentMethodManual {
+		if !auth.Allowed(c, auth.RoleCashier, auth.RoleAdmin) {
+			return auth.Error(c, fiber.StatusForbidden)
+		}
+	}
+
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	if order.Status == data.StatusExpired {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
+
+	if err := data.CheckPayment(order, request.Amount, request.Method); err != nil {
+		if errors.Is(err, data.ErrOrderPaid) {
+			return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+		}
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	p := data.Payment{Amount: request.Amount, Method: request.Method, Reference: request.Reference}
+	if p.Method != data.PaymentMethodCash {
+		captureID, err := capturePayment(c, orderID, p)
+		if err != nil {
+			return paymentError(c, err)
+		}
+		p.ProviderRef = captureID
+	}
+
+	p, err := recordPayment(c, order, p, nil)
+	if err != nil {
+		return recordPaymentError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(p)
+}
+
+// GetOrderPayments retrieves the payments recorded for an order.
+func GetOrderPayments(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	order, ok := loadOrder(c, orderID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+
+	if len(order.Payments) == 0 {
+		return c.JSON([]data.Payment{})
+	}
+
+	return c.JSON(order.Payments)
+}
+
+// capturePayment authorizes and captures the payment amount with the PaymentProvider
+// and returns the capture transaction ID.
+func capturePayment(c fiber.Ctx, orderID string, p data.Payment) (string, error) {
+	ctx, cancel := context.WithTimeout(c.UserContext(), ProviderTimeout)
+	defer cancel()
+
+	auth, err := PaymentProvider.Authorize(ctx, payment.AuthorizeRequest{
+		OrderID:   orderID,
+		Amount:    p.Amount,
+		Method:    p.Method,
+		Reference: p.Reference,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	capture, err := PaymentProvider.Capture(ctx, auth.ID, p.Amount)
+	if err != nil {
+		voidAuthorization(c, orderID, auth.ID)
+		return "", err
+	}
+	return capture.ID, nil
+}
+
+// voidAuthorization releases an authorization whose capture failed, so the amount
+// is not held on the customer's account until the authorization lapses.
+func voidAuthorization(c fiber.Ctx, orderID, authorizationID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.UserContext()), ProviderTimeout)
+	defer cancel()
+
+	logger := requestLogger(c, orderID).With("authorization_id", authorizationID)
+	if _, err := PaymentProvider.Void(ctx, authorizationID); err != nil {
+		logger.Error("voiding an uncaptured authorization failed", "error", err)
+		return
+	}
+	logger.Warn("voided an authorization whose capture failed")
+}
+
+// recordPayment records the payment on the order, applies update if given and saves
+// the order unless it changed since it was loaded. A changed order is reloaded and
+// the payment recorded again. If the payment cannot be recorded, its capture is
+// refunded, so no money is taken without a payment on the order.
+func recordPayment(c fiber.Ctx, order data.Order, p data.Payment, update func(*data.Order) error) (data.Payment, error) {
+	for attempt := 1; ; attempt++ {
+		recorded, err := data.AddPayment(&order, p)
+		if err == nil && update != nil {
+			err = update(&order)
+		}
+		if err == nil {
+			err = saveOrderIfUnchanged(c, order)
+		}
+		if err == nil {
+			return recorded, nil
+		}
+
+		if errors.Is(err, data.ErrConflict) && attempt < saveAttempts {
+			if reloaded, ok := loadOrder(c, order.ID); ok {
+				order = reloaded
+				continue
+			}
+		}
+		if p.ProviderRef != "" {
+			refundCapture(c, order.ID, p)
+		}
+		return data.Payment{}, err
+	}
+}
+
+// refundCapture returns a captured payment that could not be recorded on the order.
+func refundCapture(c fiber.Ctx, orderID string, p data.Payment) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.UserContext()), ProviderTimeout)
+	defer cancel()
+
+	logger := requestLogger(c, orderID).With("capture_id", p.ProviderRef, "amount", p.Amount)
+	if _, err := PaymentProvider.Refund(ctx, p.ProviderRef, p.Amount, p.ProviderRef); err != nil {
+		logger.Error("refunding an unrecorded capture failed", "error", err)
+		return
+	}
+	logger.Warn("refunded a capture that could not be recorded")
+}
+
+// recordPaymentError maps an error of recordPayment to a response.
+func recordPaymentError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, data.ErrConflict):
+		return orderChanged(c)
+	case errors.Is(err, data.ErrOrderPaid):
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+}
+
+// paymentError maps a PaymentProvider error to a response.
+func paymentError(c fiber.Ctx, err error) error {
+	RequestLogger(c).Warn("payment provider call failed", "error", err)
+	switch {
+	case errors.Is(err, payment.ErrDeclined):
+		return c.Status(fiber.StatusPaymentRequired).JSON("Payment declined")
+	case errors.Is(err, payment.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return c.Status(fiber.StatusGatewayTimeout).JSON("Payment provider timeout")
+	default:
+		return c.Status(fiber.StatusBadGateway).JSON("Payment provider error")
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/payment"
+	"awesomeProject/pkg/util"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// AddOrderRefund creates a manual refund for a paid order and tries to issue it.
+func AddOrderRefund(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	var request data.AddRefundRequest
+	if err := util.DecodeJSONBody(c, &request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+
+	refund, err := data.AddRefund(&order, request.Amount, data.RefundSourceManual, request.Reason)
+	if errors.Is(err, data.ErrOrderNotPaid) {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	refunds, err := saveAndIssueRefunds(c, order, refund)
+	if err != nil {
+		return saveError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(refunds[0])
+}
+
+// GetOrderRefunds retrieves the refunds of an order.
+func GetOrderRefunds(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	order, ok := loadOrder(c, orderID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+
+	if len(order.Refunds) == 0 {
+		return c.JSON([]data.Refund{})
+	}
+
+	return c.JSON(order.Refunds)
+}
+
+// saveAndIssueRefunds saves the changed order with its new pending refunds and
+// then issues them. Recording a refund before the provider call means its outcome
+// is never lost: a refund left pending is retried by RetryPendingRefunds with the
+// same idempotency keys. The caller holds the order lock. It returns the refunds
+// as issued, failed or still pending; an order changed since it was loaded is
+// not saved and ErrConflict is returned.
+func saveAndIssueRefunds(c fiber.Ctx, order data.Order, refunds ...data.Refund) ([]data.Refund, error) {
+	if err := saveOrderIfUnchanged(c, order); err != nil || len(refunds) == 0 {
+		return refunds, err
+	}
+	order, ok := loadOrder(c, order.ID)
+	if !ok {
+		return nil, data.ErrConflict
+	}
+
+	for i, refund := range refunds {
+		var err error
+		if refunds[i], err = issueRefund(c, &order, refund); err != nil {
+			return nil, err
+		}
+	}
+	if err := saveOrderIfUnchanged(c, order); err != nil {
+		// The refunds stay pending on the stored order, so the next retry resolves them.
+		requestLogger(c, order.ID).Warn("refund outcomes left for the next retry", "error", err)
+	}
+	return refunds, nil
+}
+
+// saveError maps an error of saveAndIssueRefunds to a response.
+func saveError(c fiber.Ctx, err error) error {
+	if errors.Is(err, data.ErrConflict) {
+		return orderChanged(c)
+	}
+	return internalError(c, err)
+}
+
+// issueRefund returns the money of a pending refund through the PaymentProvider.
+// Refunds of orders paid without the provider (cash) are issued directly.
+// A provider timeout leaves the refund pending for RetryPendingRefunds, any
+// other provider error fails it.
+func issueRefund(c fiber.Ctx, order *data.Order, refund data.Refund) (data.Refund, error) {
+	ctx, cancel := context.WithTimeout(c.UserContext(), ProviderTimeout)
+	defer cancel()
+	return refundOrder(ctx, requestLogger(c, order.ID), order, refund)
+}
+
+// refundOrder issues the parts of a pending refund of the order that were not
+// returned yet, each through the capture it was allotted to. The refund ID, with
+// the part number after the first part, is the idempotency key of the provider
+// calls, so retrying a refund never pays it twice.
+func refundOrder(ctx context.Context, logger *slog.Logger, order *data.Order, refund data.Refund) (data.Refund, error) {
+	for i, part := range refund.Parts {
+		if part.ProviderRef != "" {
+			continue
+		}
+		tx, err := PaymentProvider.Refund(ctx, part.CaptureID, part.Amount, refundPartKey(refund.ID, i))
+		switch {
+		case err == nil:
+			if refund, err = data.SetRefundPartRef(order, refund.ID, i, tx.ID); err != nil {
+				return refund, err
+			}
+		case errors.Is(err, payment.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+			logger.Warn("refund left pending after provider timeout", "refund_id", refund.ID, "error", err)
+			return refund, nil
+		default:
+			logger.Warn("refund failed", "refund_id", refund.ID, "capture_id", part.CaptureID, "error", err)
+			return data.SetRefundStatus(order, refund.ID, data.RefundFailed, tx.ID)
+		}
+	}
+
+	providerRef := ""
+	if len(refund.Parts) > 0 {
+		providerRef = refund.Parts[0].ProviderRef
+	}
+	return data.SetRefundStatus(order, refund.ID, data.RefundIssued, providerRef)
+}
+
+// refundPartKey returns the idempotency key of a part of a refund.
+func refundPartKey(refundID string, part int) string {
+	if part == 0 {
+		return refundID
+	}
+	return refundID + "." + strconv.Itoa(part)
+}
+
+// RetryPendingRefunds retries the refunds left pending by provider timeouts and
+// returns how many of them were issued or failed. Orders changed during a retry
+// are left for the next one.
+func RetryPendingRefunds(ctx context.Context) int {
+	var orderIDs []string
+	data.Orders.Range(func(key, value any) bool {
+		for _, refund := range value.(data.Order).Refunds {
+			if refund.Status == data.RefundPending {
+				orderIDs = append(orderIDs, key.(string))
+				break
+			}
+		}
+		return true
+	})
+
+	resolved := 0
+	for _, orderID := range orderIDs {
+		resolved += retryPendingRefunds(ctx, orderID)
+	}
+	return resolved
+}
+
+// retryPendingRefunds retries the pending refunds of an order while holding its lock.
+func retryPendingRefunds(ctx context.Context, orderID string) int {
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := util.LoadOrder(orderID)
+	if !ok {
+		return 0
+	}
+	logger := Logger.With("order_id", orderID)
+	n := 0
+	for _, refund := range order.Refunds {
+		if refund.Status != data.RefundPending {
+			continue
+		}
+		callCtx, cancel := context.WithTimeout(ctx, ProviderTimeout)
+		refund, err := refundOrder(callCtx, logger, &order, refund)
+		cancel()
+		if err == nil && refund.Status != data.RefundPending {
+			n++
+		}
+	}
+	// Parts returned before a timeout are stored even if the refund stays pending.
+	if err := data.SaveOrderIfUnchanged(order); err != nil {
+		logger.Warn("pending refunds left for the next retry", "error", err)
+		return 0
+	}
+	if n > 0 {
+		logger.Info("pending refunds retried", "resolved", n)
+	}
+	return n
+}
+
+// ReturnOrderProduct returns a quantity of an order line after payment and refunds its value.
+func ReturnOrderProduct(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	productID := c.Params("product_id")
+	var request data.ReturnProductRequest
+	if err := util.DecodeJSONBody(c, &request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	lock := orderLock(orderID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	order, ok := loadOrder(c, orderID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+
+	refund, err := data.ReturnProduct(&order, productID, request.Quantity)
+	switch {
+	case errors.Is(err, data.ErrProductNotFound):
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	case errors.Is(err, data.ErrOrderNotPaid):
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid order status")
+	case errors.Is(err, data.ErrNothingToRefund):
+		return c.Status(fiber.StatusConflict).JSON("Nothing left to refund")
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	refunds, err := saveAndIssueRefunds(c, order, refund)
+	if err != nil {
+		return saveError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(refunds[0])
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/events"
+	"awesomeProject/pkg/sse"
+	"awesomeProject/pkg/util"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+var (
+	// Streams pushes order changes to Server-Sent Events clients once started.
+	Streams = sse.NewBroker(1000)
+	// StreamHeartbeat is the interval of keep-alive comments, which also detect gone clients.
+	StreamHeartbeat = 15 * time.Second
+
+	startStreams sync.Once
+)
+
+// streamMessage is the data of every streamed event.
+type streamMessage struct {
+	Event string       `json:"event"`
+	Data  events.Event `json:"data"`
+	// Order is the order as stored right after the event.
+	Order data.Order `json:"order"`
+}
+
+// StartStreams feeds the order events published on the bus to Streams.
+func StartStreams(bus *events.Bus) {
+	startStreams.Do(func() {
+		bus.Subscribe(publishStreamMessage)
+	})
+}
+
+func publishStreamMessage(env events.Envelope) {
+	order, _ := util.LoadOrder(env.Event.AggregateID())
+	body, err := json.Marshal(streamMessage{Event: env.Event.Name(), Data: env.Event, Order: order})
+	if err != nil {
+		return
+	}
+	Streams.Publish(sse.Message{ID: env.Seq, Event: env.Event.Name(), Topic: order.ID, Data: body})
+}
+
+// StreamOrderEvents streams the changes of an order as Server-Sent Events.
+func StreamOrderEvents(c fiber.Ctx) error {
+	orderID := c.Params("order_id")
+	if _, ok := loadOrder(c, orderID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	return stream(c, func(msg sse.Message) bool { return msg.Topic == orderID })
+}
+
+// StreamAllEvents streams the changes of all orders as Server-Sent Events.
+func StreamAllEvents(c fiber.Ctx) error {
+	return stream(c, nil)
+}
+
+// stream writes every new matching message until the client is gone. Clients
+// resuming a stream with a Last-Event-ID (header or last_event_id query
+// parameter) first get the matching messages they missed.
+func stream(c fiber.Ctx, filter func(sse.Message) bool) error {
+	lastID, err := strconv.ParseUint(c.Get("Last-Event-ID", c.Query("last_event_id")), 10, 64)
+	replay, messages, cancel := Streams.Subscribe(lastID, filter)
+	if err != nil {
+		replay = nil
+	}
+	interval := StreamHeartbeat
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		for _, msg := range replay {
+			if err := msg.WriteTo(w); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(interval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if err := msg.WriteTo(w); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/tracing"
+	"awesomeProject/pkg/util"
+
+	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TracerProvider creates the request spans. Replace it to export them.
+var TracerProvider = tracing.NewProvider("go-rest-api", nil)
+
+// loadOrder loads an order in a child span of the request span.
+func loadOrder(c fiber.Ctx, orderID string) (data.Order, bool) {
+	_, span := tracing.Start(c.UserContext(), "store.load_order", attribute.String("order.id", orderID))
+	defer span.End()
+	order, ok := util.LoadOrder(orderID)
+	span.SetAttributes(attribute.Bool("order.found", ok))
+	return order, ok
+}
+
+// saveOrder stores an order in a child span of the request span and logs its business events.
+func saveOrder(c fiber.Ctx, order data.Order) {
+	_, span := tracing.Start(c.UserContext(), "store.save_order", attribute.String("order.id", order.ID))
+	defer span.End()
+	logOrderEvents(c, order)
+	before := storedOrder(order.ID)
+	data.SaveOrder(order)
+	recordChange(c, before, order)
+}
+
+// saveOrderIfUnchanged stores an order like saveOrder unless it changed since it was loaded.
+func saveOrderIfUnchanged(c fiber.Ctx, order data.Order) error {
+	_, span := tracing.Start(c.UserContext(), "store.save_order", attribute.String("order.id", order.ID))
+	defer span.End()
+	// The order cannot change between loading it here and a successful save,
+	// which checks that it is still the version the caller loaded.
+	before := storedOrder(order.ID)
+	if err := data.SaveOrderIfUnchanged(order); err != nil {
+		span.SetAttributes(attribute.Bool("order.conflict", true))
+		return err
+	}
+	logOrderEvents(c, order)
+	recordChange(c, before, order)
+	return nil
+}
+
+// calculateTotal calculates the total of the order lines in a child span of the span of ctx.
+func calculateTotal(ctx context.Context, products []data.OrderProduct) string {
+	_, span := tracing.Start(ctx, "order.calculate_total", attribute.Int("order.lines", len(products)))
+	defer span.End()
+	total := util.CalculateTotal(products)
+	span.SetAttributes(attribute.String("order.total", total))
+	return total
+}
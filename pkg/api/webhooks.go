@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/url"
+	"slices"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/util"
+	"awesomeProject/pkg/webhooks"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Webhooks delivers order events to the subscribed URLs once started.
+var Webhooks = webhooks.NewService(webhooks.Config{})
+
+type webhookRequest struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Secret *string   `json:"secret"`
+	Active *bool     `json:"active"`
+}
+
+// validate checks the given fields of the request.
+func (r webhookRequest) validate() bool {
+	if r.URL != nil {
+		u, err := url.Parse(*r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return false
+		}
+	}
+	if r.Events != nil {
+		for _, name := range *r.Events {
+			if !slices.Contains(data.EventNames, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// redact hides the secret, which is only returned when the subscription is created.
+func redact(sub webhooks.Subscription) webhooks.Subscription {
+	sub.Secret = ""
+	return sub
+}
+
+// GetWebhooks lists the webhook subscriptions.
+func GetWebhooks(c fiber.Ctx) error {
+	subs := Webhooks.List()
+	for i := range subs {
+		subs[i] = redact(subs[i])
+	}
+	return c.JSON(subs)
+}
+
+// CreateWebhook subscribes a URL to order events.
+func CreateWebhook(c fiber.Ctx) error {
+	var request webhookRequest
+	if err := util.DecodeJSONBody(c, &request); err != nil || request.URL == nil || !request.validate() {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	sub := webhooks.Subscription{URL: *request.URL, Events: []string{}, Active: true}
+	if request.Events != nil {
+		sub.Events = *request.Events
+	}
+	if request.Secret != nil {
+		sub.Secret = *request.Secret
+	}
+	if request.Active != nil {
+		sub.Active = *request.Active
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(Webhooks.Create(sub))
+}
+
+// GetWebhook retrieves a webhook subscription.
+func GetWebhook(c fiber.Ctx) error {
+	sub, ok := Webhooks.Get(c.Params("webhook_id"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	return c.JSON(redact(sub))
+}
+
+// UpdateWebhook changes the given fields of a webhook subscription.
+func UpdateWebhook(c fiber.Ctx) error {
+	var request webhookRequest
+	if err := util.DecodeJSONBody(c, &request); err != nil || !request.validate() {
+		return c.Status(fiber.StatusBadRequest).JSON("Invalid parameters")
+	}
+
+	sub, ok := Webhooks.Update(c.Params("webhook_id"), func(sub *webhooks.Subscription) {
+		if request.URL != nil {
+			sub.URL = *request.URL
+		}
+		if request.Events != nil {
+			sub.Events = *request.Events
+		}
+		if request.Secret != nil && *request.Secret != "" {
+			sub.Secret = *request.Secret
+		}
+		if request.Active != nil {
+			sub.Active = *request.Active
+		}
+	})
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	return c.JSON(redact(sub))
+}
+
+// DeleteWebhook removes a webhook subscription and its delivery log.
+func DeleteWebhook(c fiber.Ctx) error {
+	if !Webhooks.Delete(c.Params("webhook_id")) {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+	return c.Status(fiber.StatusOK).JSON("OK")
+}
+
+// GetWebhookDeliveries retrieves the latest delivery attempts of a webhook subscription.
+func GetWebhookDeliveries(c fiber.Ctx) error {
+	id := c.Params("webhook_id")
+	if _, ok := Webhooks.Get(id); !ok {
+		return c.Status(fiber.StatusNotFound).JSON("Not Found")
+	}
+
+	deliveries := Webhooks.Deliveries(id)
+	if len(deliveries) == 0 {
+		return c.JSON([]webhooks.Delivery{})
+	}
+	return c.JSON(deliveries)
+}
+
+// GetWebhookDeadLetters retrieves the events that could not be delivered.
+func GetWebhookDeadLetters(c fiber.Ctx) error {
+	deadLetters := Webhooks.DeadLetters()
+	if len(deadLetters) == 0 {
+		return c.JSON([]webhooks.DeadLetter{})
+	}
+	return c.JSON(deadLetters)
+}
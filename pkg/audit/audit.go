@@ -0,0 +1,300 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Change is the value of a field before and after a request. A missing value is null.
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Entry records one state-changing request. Entries are chained: Hash covers
+// the entry including PrevHash, the Hash of the entry before it, so changing or
+// removing an entry breaks the chain from there on.
+type Entry struct {
+	Seq       uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Actor     string            `json:"actor"`
+	RequestID string            `json:"request_id"`
+	Method    string            `json:"method"`
+	Route     string            `json:"route"`
+	Path      string            `json:"path"`
+	Status    int               `json:"status"`
+	OrderID   string            `json:"order_id,omitempty"`
+	Changes   map[string]Change `json:"changes,omitempty"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+}
+
+// Filter selects entries; zero fields match everything.
+type Filter struct {
+	// After skips the entries up to and including this sequence number.
+	After   uint64
+	OrderID string
+	Actor   string
+	From    time.Time
+	To      time.Time
+}
+
+func (f Filter) match(e Entry) bool {
+	return e.Seq > f.After &&
+		(f.OrderID == "" || e.OrderID == f.OrderID) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || !e.Time.After(f.To))
+}
+
+// Log is an append-only, hash-chained audit log of JSON lines. Only the head
+// of the chain is kept in memory; reads scan the written lines.
+type Log struct {
+	mu sync.RWMutex
+	// file holds the lines of a file log, lines those of an in-memory log.
+	file  *os.File
+	lines []byte
+	// size is the length of the complete lines written so far.
+	size     int64
+	lastSeq  uint64
+	lastHash string
+}
+
+// NewLog returns an in-memory log.
+func NewLog() *Log {
+	return &Log{}
+}
+
+// OpenFile returns a log appending to the file at path. Existing entries are
+// verified first, so the chain continues across restarts.
+func OpenFile(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := &Log{file: file, size: info.Size()}
+	var chain verifier
+	if err := l.scan(func(entry Entry) error { return chain.check(entry) }); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("audit log %s: %w", path, err)
+	}
+	l.lastSeq, l.lastHash = chain.seq, chain.prev
+	return l, nil
+}
+
+// ReadFile reads the entries of a log file.
+func ReadFile(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read reads JSON lines entries.
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	err := scan(r, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// errStop ends a scan early without an error.
+var errStop = errors.New("stop")
+
+// scan calls fn with every JSON lines entry of r until fn returns an error.
+func scan(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// scan calls fn with the entries written so far. The caller holds l.mu.
+func (l *Log) scan(fn func(Entry) error) error {
+	var r io.Reader
+	if l.file != nil {
+		r = io.NewSectionReader(l.file, 0, l.size)
+	} else {
+		r = bytes.NewReader(l.lines)
+	}
+	if err := scan(r, fn); err != nil && !errors.Is(err, errStop) {
+		return err
+	}
+	return nil
+}
+
+// Append chains the entry to the log and returns it with Seq, PrevHash and Hash set.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.lastSeq + 1
+	entry.PrevHash = l.lastHash
+	hash, err := Hash(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	line = append(line, '\n')
+	if l.file != nil {
+		if _, err := l.file.Write(line); err != nil {
+			return Entry{}, err
+		}
+	} else {
+		l.lines = append(l.lines, line...)
+	}
+	l.size += int64(len(line))
+	l.lastSeq, l.lastHash = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// Entries returns up to limit entries matching the filter, oldest first. A
+// limit of 0 or less returns all of them.
+func (l *Log) Entries(f Filter, limit int) ([]Entry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var entries []Entry
+	err := l.scan(func(e Entry) error {
+		if !f.match(e) {
+			return nil
+		}
+		entries = append(entries, e)
+		if len(entries) == limit {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Verify verifies the whole log, including that it ends at the head appended last.
+func (l *Log) Verify() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var chain verifier
+	if err := l.scan(chain.check); err != nil {
+		return err
+	}
+	if chain.seq != l.lastSeq || chain.prev != l.lastHash {
+		return fmt.Errorf("entry %d: missing", chain.seq+1)
+	}
+	return nil
+}
+
+// Close syncs and closes the log file, if any. A closed file log cannot be
+// appended to or read.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := errors.Join(l.file.Sync(), l.file.Close())
+	l.file = nil
+	l.size = 0
+	return err
+}
+
+// Hash returns the hex SHA-256 of the JSON form of the entry without its Hash.
+func Hash(entry Entry) (string, error) {
+	entry.Hash = ""
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks that the entries form an unbroken chain starting at the first entry.
+func Verify(entries []Entry) error {
+	var chain verifier
+	for _, entry := range entries {
+		if err := chain.check(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyFile checks the chain of a log file without loading it and returns
+// the number of entries and the last hash.
+func VerifyFile(path string) (uint64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	var chain verifier
+	if err := scan(file, chain.check); err != nil {
+		return 0, "", err
+	}
+	return chain.seq, chain.prev, nil
+}
+
+// verifier checks entries one by one against the chain before them.
+type verifier struct {
+	seq  uint64
+	prev string
+}
+
+func (v *verifier) check(entry Entry) error {
+	if entry.Seq != v.seq+1 {
+		return fmt.Errorf("entry %d: unexpected sequence number %d", v.seq+1, entry.Seq)
+	}
+	if entry.PrevHash != v.prev {
+		return fmt.Errorf("entry %d: previous hash does not match", entry.Seq)
+	}
+	hash, err := Hash(entry)
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", entry.Seq, err)
+	}
+	if hash != entry.Hash {
+		return fmt.Errorf("entry %d: hash does not match its content", entry.Seq)
+	}
+	v.seq, v.prev = entry.Seq, entry.Hash
+	return nil
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogChainAndTampering(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	log, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, actor := range []string{"alice", "bob", "alice"} {
+		if _, err := log.Append(Entry{Time: time.Now().UTC(), Actor: actor, Method: "POST", Path: "/api/orders"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, err := log.Entries(Filter{Actor: "alice"}, 0); err != nil || len(entries) != 2 {
+		t.Errorf("entries of alice: got %d, %v, want 2", len(entries), err)
+	}
+	if page, err := log.Entries(Filter{After: 1}, 1); err != nil || len(page) != 1 || page[0].Seq != 2 {
+		t.Errorf("page after entry 1: got %+v, %v, want entry 2", page, err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening continues the chain.
+	log, err = OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := log.Append(Entry{Actor: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	if entry.Seq != 4 || entry.PrevHash == "" {
+		t.Errorf("chain not continued: %+v", entry)
+	}
+
+	if n, hash, err := VerifyFile(path); err != nil || n != 4 || hash != entry.Hash {
+		t.Errorf("verifying the file: got %d entries, last hash %q, %v", n, hash, err)
+	}
+
+	entries, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(entries); err != nil {
+		t.Fatalf("untouched log: %v", err)
+	}
+
+	tampered := append([]Entry(nil), entries...)
+	tampered[1].Actor = "mallory"
+	if Verify(tampered) == nil {
+		t.Error("changed entry not detected")
+	}
+	if Verify(append(entries[:1:1], entries[2:]...)) == nil {
+		t.Error("removed entry not detected")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	type line struct {
+		ID       string `json:"id"`
+		Quantity int    `json:"quantity"`
+	}
+	type order struct {
+		Status   string `json:"status"`
+		Products []line `json:"products"`
+	}
+
+	before := &order{Status: "NEW", Products: []line{{ID: "a", Quantity: 1}}}
+	after := &order{Status: "PAID", Products: []line{{ID: "a", Quantity: 2}, {ID: "b", Quantity: 1}}}
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Change{
+		"status":              {Before: "NEW", After: "PAID"},
+		"products.0.quantity": {Before: float64(1), After: float64(2)},
+		"products.1.id":       {Before: nil, After: "b"},
+		"products.1.quantity": {Before: nil, After: float64(1)},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %v", len(changes), len(want), changes)
+	}
+	for path, change := range want {
+		if changes[path] != change {
+			t.Errorf("%s: got %v, want %v", path, changes[path], change)
+		}
+	}
+}
+
+// Test that an open log detects entries removed from the end of its file.
+func TestLogVerifyTruncated(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	log, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for _, actor := range []string{"alice", "bob"} {
+		if _, err := log.Append(Entry{Actor: actor}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := log.Verify(); err != nil {
+		t.Fatalf("untouched log: %v", err)
+	}
+
+	entries, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := json.Marshal(entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, int64(len(line))+1); err != nil {
+		t.Fatal(err)
+	}
+	if log.Verify() == nil {
+		t.Error("removed last entry not detected")
+	}
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+)
+
+// Diff returns the changed fields between the JSON forms of before and after,
+// keyed by their dotted path, e.g. "amount.total" or "products.0.quantity".
+// A nil before or after stands for a value that does not exist.
+func Diff(before, after any) (map[string]Change, error) {
+	a, err := document(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := document(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	diff("", a, b, changes)
+	return changes, nil
+}
+
+func document(v any) (any, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	err = json.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+func diff(path string, a, b any, changes map[string]Change) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+
+	// A missing object or list is compared as an empty one, so every field is listed.
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+	if aIsMap && b == nil || a == nil && bIsMap {
+		aIsMap, bIsMap = true, true
+	}
+	if aIsMap && bIsMap {
+		for key, av := range aMap {
+			diff(join(path, key), av, bMap[key], changes)
+		}
+		for key, bv := range bMap {
+			if _, ok := aMap[key]; !ok {
+				diff(join(path, key), nil, bv, changes)
+			}
+		}
+		return
+	}
+
+	aList, aIsList := a.([]any)
+	bList, bIsList := b.([]any)
+	if aIsList && b == nil || a == nil && bIsList {
+		aIsList, bIsList = true, true
+	}
+	if aIsList && bIsList {
+		for i := 0; i < max(len(aList), len(bList)); i++ {
+			var av, bv any
+			if i < len(aList) {
+				av = aList[i]
+			}
+			if i < len(bList) {
+				bv = bList[i]
+			}
+			diff(join(path, strconv.Itoa(i)), av, bv, changes)
+		}
+		return
+	}
+
+	changes[path] = Change{Before: a, After: b}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
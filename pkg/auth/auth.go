@@ -0,0 +1,163 @@
+// Package auth authenticates API requests and carries the authenticated principal.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Roles, from least to most privileged.
+const (
+	RoleCustomer = "customer"
+	RoleCashier  = "cashier"
+	RoleAdmin    = "admin"
+)
+
+// Roles lists all roles.
+var Roles = []string{RoleCustomer, RoleCashier, RoleAdmin}
+
+var (
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+	ErrInvalidKey      = errors.New("invalid API key configuration")
+)
+
+// HeaderAPIKey carries the API key of a request.
+const HeaderAPIKey = "X-API-Key"
+
+const principalKey = "auth.principal"
+
+// Authentication methods. The subjects of different methods are unrelated: an
+// API key name may equal a JWT subject or a certificate common name.
+const (
+	MethodAPIKey     = "api_key"
+	MethodJWT        = "jwt"
+	MethodClientCert = "client_cert"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Method  string `json:"method"`
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+}
+
+// Owner returns the subject qualified by its authentication method, as stored on
+// the orders the principal creates.
+func (p Principal) Owner() string {
+	return p.Method + ":" + p.Subject
+}
+
+// Key is a configured API key. Only the hex SHA-256 of the key is stored.
+type Key struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Hash string `json:"hash"`
+}
+
+// HashKey returns the hex SHA-256 of an API key, as stored in Key.Hash.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadKeys reads a JSON array of keys from a file.
+func LoadKeys(path string) ([]Key, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// Authenticator authenticates requests by their credentials.
+type Authenticator struct {
+	keys map[string]Key
+
+	jwtKeys  []jwk
+	issuer   string
+	audience string
+
+	// clientCerts maps client certificate common names to roles; nil disables client certificates.
+	clientCerts map[string]string
+}
+
+// NewAuthenticator returns an authenticator accepting the given API keys.
+func NewAuthenticator(keys []Key) (*Authenticator, error) {
+	a := &Authenticator{keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		hash, err := hex.DecodeString(key.Hash)
+		if key.Name == "" || !slices.Contains(Roles, key.Role) || err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%w: key %q", ErrInvalidKey, key.Name)
+		}
+		a.keys[hex.EncodeToString(hash)] = key
+	}
+	return a, nil
+}
+
+// Authenticate returns the principal of the request credentials: a bearer
+// token in the Authorization header, an API key or a client certificate.
+func (a *Authenticator) Authenticate(c fiber.Ctx) (Principal, error) {
+	if token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		return a.verifyToken(token, time.Now())
+	}
+	if apiKey := c.Get(HeaderAPIKey); apiKey != "" {
+		// The key is looked up by its hash, which reveals nothing about other keys.
+		if key, ok := a.keys[HashKey(apiKey)]; ok {
+			return Principal{Method: MethodAPIKey, Subject: key.Name, Role: key.Role}, nil
+		}
+		return Principal{}, ErrUnauthenticated
+	}
+	if p, ok := a.clientCertPrincipal(c.Context().TLSConnectionState()); ok {
+		return p, nil
+	}
+	return Principal{}, ErrUnauthenticated
+}
+
+// SetPrincipal stores the authenticated principal of the request.
+func SetPrincipal(c fiber.Ctx, p Principal) {
+	c.Locals(principalKey, p)
+}
+
+// PrincipalFrom returns the authenticated principal of the request, if any.
+func PrincipalFrom(c fiber.Ctx) (Principal, bool) {
+	p, ok := c.Locals(principalKey).(Principal)
+	return p, ok
+}
+
+// IsStaff reports whether the principal acts for the shop rather than as a customer.
+func (p Principal) IsStaff() bool {
+	return p.Role == RoleCashier || p.Role == RoleAdmin
+}
+
+// Allowed reports whether the caller has one of the roles.
+// Requests without a principal are allowed: authentication is disabled or the route is public.
+func Allowed(c fiber.Ctx, roles ...string) bool {
+	p, ok := PrincipalFrom(c)
+	return !ok || slices.Contains(roles, p.Role)
+}
+
+// Error writes an authentication or authorization error in the API error format.
+func Error(c fiber.Ctx, status int) error {
+	if status == fiber.StatusUnauthorized {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer, ApiKey header="`+HeaderAPIKey+`"`)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"errors": fiber.Map{
+			"detail": http.StatusText(status),
+		},
+	})
+}
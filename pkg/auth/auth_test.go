@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeys(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"name": "till-1", "role": "cashier", "hash": "` + HashKey("secret") + `"}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAuthenticator(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := a.keys[HashKey("secret")]; key.Name != "till-1" || key.Role != RoleCashier {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	for _, key := range []Key{
+		{Name: "x", Role: "owner", Hash: HashKey("secret")},
+		{Name: "x", Role: RoleAdmin, Hash: "secret"},
+		{Role: RoleAdmin, Hash: HashKey("secret")},
+	} {
+		if _, err := NewAuthenticator([]Key{key}); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("key %+v: got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
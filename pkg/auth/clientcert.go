@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ConfigureClientCerts authenticates requests on TLS connections with a
+// verified client certificate, for service-to-service calls. The principal is
+// the common name of the certificate subject, with its role from roles, given
+// as "<common name>=<role>"; other common names are customers.
+// Credentials in the request headers take precedence over the certificate.
+func (a *Authenticator) ConfigureClientCerts(roles []string) error {
+	a.clientCerts = make(map[string]string, len(roles))
+	for _, entry := range roles {
+		name, role, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || !slices.Contains(Roles, role) {
+			return fmt.Errorf("invalid client certificate role %q, want <common name>=<role>", entry)
+		}
+		a.clientCerts[name] = role
+	}
+	return nil
+}
+
+// clientCertPrincipal returns the principal of the verified client certificate
+// of the connection, if any.
+func (a *Authenticator) clientCertPrincipal(state *tls.ConnectionState) (Principal, bool) {
+	// Only verified chains are trusted; PeerCertificates are whatever the client sent.
+	if a.clientCerts == nil || state == nil || len(state.VerifiedChains) == 0 {
+		return Principal{}, false
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return Principal{}, false
+	}
+	role, ok := a.clientCerts[name]
+	if !ok {
+		role = RoleCustomer
+	}
+	return Principal{Method: MethodClientCert, Subject: name, Role: role}, true
+}
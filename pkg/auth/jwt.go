@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported JWT signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// clockSkew is tolerated when checking the time claims of a token.
+const clockSkew = time.Minute
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig configures the verification of bearer tokens. A token is accepted
+// if it is signed by one of the configured keys and its claims are valid.
+type JWTConfig struct {
+	// HMACSecret verifies HS256 tokens.
+	HMACSecret string
+	// RSAPublicKeyFile is a PEM file with a public key verifying RS256 tokens.
+	RSAPublicKeyFile string
+	// JWKSFile is a JSON Web Key Set file with RSA and symmetric ("oct") keys.
+	JWKSFile string
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+}
+
+// jwk is a verification key. An empty kid matches any token kid.
+type jwk struct {
+	kid    string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// claims are the registered claims checked by the Authenticator, plus the role.
+type claims struct {
+	Subject   string   `json:"sub"`
+	Role      string   `json:"role"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+}
+
+// audience is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(raw []byte) error {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(raw, (*[]string)(a))
+}
+
+// ConfigureJWT adds the keys of the configuration to the accepted bearer token keys.
+func (a *Authenticator) ConfigureJWT(cfg JWTConfig) error {
+	if cfg.HMACSecret != "" {
+		a.jwtKeys = append(a.jwtKeys, jwk{alg: AlgHS256, secret: []byte(cfg.HMACSecret)})
+	}
+	if cfg.RSAPublicKeyFile != "" {
+		public, err := loadRSAPublicKey(cfg.RSAPublicKeyFile)
+		if err != nil {
+			return err
+		}
+		a.jwtKeys = append(a.jwtKeys, jwk{alg: AlgRS256, public: public})
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return err
+		}
+		a.jwtKeys = append(a.jwtKeys, keys...)
+	}
+	a.issuer, a.audience = cfg.Issuer, cfg.Audience
+	return nil
+}
+
+// verifyToken checks the signature and claims of a compact JWT and returns its principal.
+// The role claim defaults to customer.
+func (a *Authenticator) verifyToken(token string, now time.Time) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := slices.ContainsFunc(a.jwtKeys, func(key jwk) bool {
+		return key.alg == header.Alg && (key.kid == "" || key.kid == header.Kid) && key.verify(signed, signature)
+	})
+	if !verified {
+		return Principal{}, ErrInvalidToken
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if c.Role == "" {
+		c.Role = RoleCustomer
+	}
+	switch {
+	case c.Subject == "", !slices.Contains(Roles, c.Role):
+	case c.ExpiresAt == nil || now.Add(-clockSkew).Unix() >= *c.ExpiresAt:
+	case c.NotBefore != nil && now.Add(clockSkew).Unix() < *c.NotBefore:
+	case a.issuer != "" && c.Issuer != a.issuer:
+	case a.audience != "" && !slices.Contains(c.Audience, a.audience):
+	default:
+		return Principal{Method: MethodJWT, Subject: c.Subject, Role: c.Role}, nil
+	}
+	return Principal{}, ErrInvalidToken
+}
+
+func (key jwk) verify(signed, signature []byte) bool {
+	switch key.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case AlgRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.public, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	public, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA public key", path)
+	}
+	return public, nil
+}
+
+// loadJWKS reads the RSA and "oct" keys of a JSON Web Key Set file.
+// Keys with another type or algorithm, or meant for encryption, are skipped.
+func loadJWKS(path string) ([]jwk, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var keys []jwk
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == AlgRS256):
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("%s: invalid RSA key %q", path, k.Kid)
+			}
+			public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			keys = append(keys, jwk{kid: k.Kid, alg: AlgRS256, public: public})
+		case k.Kty == "oct" && (k.Alg == "" || k.Alg == AlgHS256):
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("%s: invalid symmetric key %q", path, k.Kid)
+			}
+			keys = append(keys, jwk{kid: k.Kid, alg: AlgHS256, secret: secret})
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyToken(t *testing.T) {
+	t.Parallel()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "rsa-1",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	raw, _ := json.Marshal(jwks)
+	if err := os.WriteFile(jwksFile, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ConfigureJWT(JWTConfig{HMACSecret: "secret", JWKSFile: jwksFile, Issuer: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	valid := map[string]any{"sub": "alice", "iss": "shop", "exp": now.Add(time.Hour).Unix()}
+	with := func(key string, value any) map[string]any {
+		c := map[string]any{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		c[key] = value
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  Principal
+	}{
+		{"HS256", signHS256(t, "secret", valid), Principal{Method: MethodJWT, Subject: "alice", Role: RoleCustomer}},
+		{"RS256 from JWKS", signRS256(t, rsaKey, "rsa-1", with("role", RoleAdmin)), Principal{Method: MethodJWT, Subject: "alice", Role: RoleAdmin}},
+		{"wrong secret", signHS256(t, "other", valid), Principal{}},
+		{"unknown kid", signRS256(t, rsaKey, "rsa-2", valid), Principal{}},
+		{"expired", signHS256(t, "secret", with("exp", now.Add(-time.Hour).Unix())), Principal{}},
+		{"no expiry", signHS256(t, "secret", with("exp", nil)), Principal{}},
+		{"wrong issuer", signHS256(t, "secret", with("iss", "other")), Principal{}},
+		{"unknown role", signHS256(t, "secret", with("role", "owner")), Principal{}},
+		{"alg none", encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, valid) + ".", Principal{}},
+	}
+	for _, tt := range tests {
+		got, err := a.verifyToken(tt.token, now)
+		if got != tt.want || (tt.want == Principal{}) != (err != nil) {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]any) string {
+	signed := encodeSegment(t, map[string]string{"alg": AlgHS256, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	signed := encodeSegment(t, map[string]string{"alg": AlgRS256, "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
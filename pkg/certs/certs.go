@@ -0,0 +1,103 @@
+// Package certs serves TLS certificates that are reloaded when their files are
+// rotated, and loads the CA bundles verifying client certificates.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves the certificate of a certificate and key file pair. At most
+// once per interval, on a handshake, it checks whether the files changed and
+// loads them again. A pair that fails to load, such as a certificate written
+// before its key, is logged and the previous certificate is served until the
+// next check.
+type Reloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+	now               func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamp   string
+	checked time.Time
+}
+
+// NewReloader loads the certificate and key files. An interval of 0 disables reloading.
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, interval: interval, now: time.Now}
+	r.checked = r.now()
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := r.now(); r.interval > 0 && now.Sub(r.checked) >= r.interval {
+		r.checked = now
+		reloaded, err := r.reload()
+		if err != nil {
+			slog.Warn("reloading TLS certificate failed, serving the previous one", "cert_file", r.certFile, "error", err)
+		} else if reloaded {
+			slog.Info("TLS certificate reloaded", "cert_file", r.certFile, "not_after", r.cert.Leaf.NotAfter)
+		}
+	}
+	return r.cert, nil
+}
+
+// reload loads the files if their size or modification time changed.
+func (r *Reloader) reload() (bool, error) {
+	stamp, err := fileStamp(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if stamp == r.stamp {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return false, err
+		}
+	}
+	r.cert, r.stamp = &cert, stamp
+	return true, nil
+}
+
+func fileStamp(paths ...string) (string, error) {
+	var stamp string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// LoadCAPool reads a PEM bundle of CA certificates.
+func LoadCAPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return pool, nil
+}
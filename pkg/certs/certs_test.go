@@ -0,0 +1,86 @@
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/certs/certstest"
+)
+
+// touch moves the modification time of the files forward, as file systems may
+// not tell writes within the same tick apart.
+func touch(t *testing.T, mtime time.Time, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certstest.Issue(t, "v1", nil).WriteFiles(t, certFile, keyFile)
+
+	r, err := NewReloader(certFile, keyFile, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	commonName := func() string {
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	if name := commonName(); name != "v1" {
+		t.Fatalf("serving %q, want v1", name)
+	}
+
+	// Rotated files are loaded on the first handshake after the interval.
+	certstest.Issue(t, "v2", nil).WriteFiles(t, certFile, keyFile)
+	touch(t, time.Now().Add(time.Second), certFile, keyFile)
+	if name := commonName(); name != "v1" {
+		t.Errorf("reloaded within the interval: serving %q", name)
+	}
+	now = now.Add(time.Minute)
+	if name := commonName(); name != "v2" {
+		t.Errorf("serving %q after rotation, want v2", name)
+	}
+
+	// A broken pair keeps the previous certificate until it is fixed.
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if name := commonName(); name != "v2" {
+		t.Errorf("serving %q with a broken key, want v2", name)
+	}
+	certstest.Issue(t, "v3", nil).WriteFiles(t, certFile, keyFile)
+	touch(t, time.Now().Add(2*time.Second), certFile, keyFile)
+	now = now.Add(time.Minute)
+	if name := commonName(); name != "v3" {
+		t.Errorf("serving %q after the fix, want v3", name)
+	}
+
+	if _, err := NewReloader(certFile, filepath.Join(dir, "missing.key"), time.Minute); err == nil {
+		t.Error("missing key accepted")
+	}
+}
+
+func TestLoadCAPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	certstest.Issue(t, "ca", nil).WriteFiles(t, certFile, keyFile)
+	if _, err := LoadCAPool(certFile); err != nil {
+		t.Error(err)
+	}
+	if _, err := LoadCAPool(keyFile); err == nil {
+		t.Error("bundle without certificates accepted")
+	}
+}
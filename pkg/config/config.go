@@ -0,0 +1,469 @@
+// Package config loads the API configuration from defaults, a TOML file,
+// environment variables and command line flags, each overriding the one before.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"awesomeProject/pkg/auth"
+	"awesomeProject/pkg/ratelimit"
+)
+
+// Config is the configuration of the API.
+type Config struct {
+	Server     Server
+	TLS        TLS
+	Admin      Admin
+	Store      Store
+	Catalog    Catalog
+	Auth       Auth
+	CORS       CORS
+	RateLimits RateLimits
+	Orders     Orders
+	Audit      Audit
+	Tracing    Tracing
+	Log        Log
+}
+
+type Server struct {
+	// Listen is the address the API listens on, as ":3000" or "127.0.0.1:3000".
+	Listen string
+	// ReadTimeout, WriteTimeout and IdleTimeout bound the reading of a request, the
+	// writing of a response and idle keep-alive connections; 0 means no limit.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownDelay is how long readiness fails before the listener closes,
+	// ShutdownTimeout how long in-flight requests may take to finish.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+}
+
+type TLS struct {
+	// CertFile and KeyFile enable HTTPS. Rotated files are loaded again,
+	// checked at most once per ReloadInterval; 0 disables reloading.
+	CertFile       string
+	KeyFile        string
+	ReloadInterval time.Duration
+	// ClientCAFile is a PEM bundle verifying client certificates; empty disables them.
+	// ClientAuth is "optional", accepting clients without a certificate, or "require".
+	ClientCAFile string
+	ClientAuth   string
+	// ClientRoles maps client certificate common names to roles as "<common name>=<role>".
+	ClientRoles []string
+}
+
+type Admin struct {
+	// Listen is the address of the listener of metrics, pprof, the catalog admin and the
+	// configuration, as "127.0.0.1:9090" or "unix:/run/api/admin.sock"; empty, the default, disables it.
+	// A TCP listener requires authentication and is served with the TLS settings of
+	// the API; without a certificate it must be a loopback address.
+	Listen string
+	// APIKeys is a JSON file of the API keys of the admin listener, of which only admin
+	// keys are accepted. Empty falls back to the admins of the API authentication, or
+	// without that leaves a Unix socket open to whoever can connect to it.
+	APIKeys string
+}
+
+type Store struct {
+	// Backend is the order store; only "memory" is available.
+	Backend string
+	DSN     string
+}
+
+type Catalog struct {
+	// Source is a JSON file of products; empty serves the built-in catalog.
+	Source string
+}
+
+type Auth struct {
+	// APIKeys is a JSON file of API keys. Without keys and token keys authentication is disabled.
+	APIKeys string
+	JWT     auth.JWTConfig
+}
+
+// Enabled reports whether API keys or token keys are configured.
+func (a Auth) Enabled() bool {
+	return a.APIKeys != "" || a.JWT.HMACSecret != "" || a.JWT.RSAPublicKeyFile != "" || a.JWT.JWKSFile != ""
+}
+
+type CORS struct {
+	// AllowOrigins lists the origins allowed to call the API from a browser,
+	// "*" for any; empty disables CORS.
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+type RateLimits struct {
+	// IP is the "<requests per second>[:<burst>]" rule of all requests per client IP address,
+	// checked before authentication so that rejected credentials count as well; empty disables it.
+	IP string
+	// Read, Write and Admin are "<requests per second>[:<burst>]" rules per
+	// client of the route groups; empty disables the limit.
+	Read  string
+	Write string
+	Admin string
+	// OrderQuota is the number of orders a client may create per day; 0 disables the quota.
+	OrderQuota int
+}
+
+type Orders struct {
+	// TTL and Retention configure the expiry and purging of abandoned orders; 0 disables them.
+	TTL       time.Duration
+	Retention time.Duration
+}
+
+type Audit struct {
+	// Log is the file the audit log is appended to; empty keeps it in memory only.
+	Log string
+}
+
+type Tracing struct {
+	// Exporter is where spans are exported: "none", "stdout" or "file" (File, as JSON lines).
+	Exporter string
+	File     string
+}
+
+type Log struct {
+	// Format is "json" or "text", Level one of debug, info, warn and error.
+	Format string
+	Level  string
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Listen:          ":3000",
+			ReadTimeout:     30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		TLS:   TLS{ReloadInterval: 30 * time.Second, ClientAuth: "optional"},
+		Store: Store{Backend: "memory"},
+		CORS: CORS{
+			AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowHeaders:  []string{"Authorization", "Content-Type", "X-API-Key", "Last-Event-ID", "traceparent"},
+			ExposeHeaders: []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "WWW-Authenticate", "traceresponse", "ETag"},
+			MaxAge:        10 * time.Minute,
+		},
+		RateLimits: RateLimits{IP: "100:200", Read: "50:100", Write: "10:20", Admin: "5:10", OrderQuota: 1000},
+		Orders:     Orders{TTL: 24 * time.Hour, Retention: 7 * 24 * time.Hour},
+		Tracing:    Tracing{Exporter: "none", File: "traces.jsonl"},
+		Log:        Log{Format: "json", Level: "info"},
+	}
+}
+
+// setting is one configuration value with its key in the file, its environment
+// variable and its flag.
+type setting struct {
+	key    string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	value  value
+}
+
+// settings returns the settings of cfg, in the order they are printed.
+func settings(cfg *Config) []setting {
+	return []setting{
+		{key: "server.listen", env: "LISTEN_ADDR", flag: "listen", usage: "Address to listen on", value: (*stringValue)(&cfg.Server.Listen)},
+		{key: "server.read_timeout", env: "READ_TIMEOUT", flag: "read-timeout", usage: "Time to read a request", value: (*durationValue)(&cfg.Server.ReadTimeout)},
+		{key: "server.write_timeout", env: "WRITE_TIMEOUT", flag: "write-timeout", usage: "Time to write a response, event streams included", value: (*durationValue)(&cfg.Server.WriteTimeout)},
+		{key: "server.idle_timeout", env: "IDLE_TIMEOUT", flag: "idle-timeout", usage: "Time keep-alive connections may stay idle", value: (*durationValue)(&cfg.Server.IdleTimeout)},
+		{key: "server.shutdown_delay", env: "SHUTDOWN_DELAY", flag: "shutdown-delay", usage: "Time readiness fails before the server stops accepting connections", value: (*durationValue)(&cfg.Server.ShutdownDelay)},
+		{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "Time in-flight requests may take to finish on shutdown", value: (*durationValue)(&cfg.Server.ShutdownTimeout)},
+
+		{key: "tls.cert_file", env: "TLS_CERT_FILE", flag: "tls-cert", usage: "PEM certificate file, enables HTTPS", value: (*stringValue)(&cfg.TLS.CertFile)},
+		{key: "tls.key_file", env: "TLS_KEY_FILE", flag: "tls-key", usage: "PEM private key file of the certificate", value: (*stringValue)(&cfg.TLS.KeyFile)},
+		{key: "tls.reload_interval", env: "TLS_RELOAD_INTERVAL", flag: "tls-reload-interval", usage: "Time between checks for rotated certificate files", value: (*durationValue)(&cfg.TLS.ReloadInterval)},
+		{key: "tls.client_ca_file", env: "TLS_CLIENT_CA_FILE", flag: "tls-client-ca", usage: "PEM bundle of CAs verifying client certificates", value: (*stringValue)(&cfg.TLS.ClientCAFile)},
+		{key: "tls.client_auth", env: "TLS_CLIENT_AUTH", flag: "tls-client-auth", usage: "Client certificates: optional or require", value: (*stringValue)(&cfg.TLS.ClientAuth)},
+		{key: "tls.client_roles", env: "TLS_CLIENT_ROLES", flag: "tls-client-roles", usage: "Comma separated roles of client certificate common names as <common name>=<role>", value: (*listValue)(&cfg.TLS.ClientRoles)},
+
+		{key: "admin.listen", env: "ADMIN_LISTEN", flag: "admin-listen", usage: "Address of the admin listener, unix:<path> for a Unix socket", value: (*stringValue)(&cfg.Admin.Listen)},
+		{key: "admin.api_keys", env: "ADMIN_API_KEYS", flag: "admin-api-keys", usage: "JSON file of hashed API keys of the admin listener", value: (*stringValue)(&cfg.Admin.APIKeys)},
+
+		{key: "store.backend", env: "STORE_BACKEND", flag: "store-backend", usage: "Order store: memory", value: (*stringValue)(&cfg.Store.Backend)},
+		{key: "store.dsn", env: "STORE_DSN", flag: "store-dsn", usage: "Connection string of the order store", secret: true, value: (*stringValue)(&cfg.Store.DSN)},
+
+		{key: "catalog.source", env: "CATALOG_SOURCE", flag: "catalog", usage: "JSON file of products instead of the built-in catalog", value: (*stringValue)(&cfg.Catalog.Source)},
+
+		{key: "auth.api_keys", env: "API_KEYS", flag: "api-keys", usage: "JSON file of hashed API keys", value: (*stringValue)(&cfg.Auth.APIKeys)},
+		{key: "auth.jwt_secret", env: "JWT_SECRET", flag: "jwt-secret", usage: "Secret verifying HS256 bearer tokens", secret: true, value: (*stringValue)(&cfg.Auth.JWT.HMACSecret)},
+		{key: "auth.jwt_public_key", env: "JWT_PUBLIC_KEY", flag: "jwt-public-key", usage: "PEM public key verifying RS256 bearer tokens", value: (*stringValue)(&cfg.Auth.JWT.RSAPublicKeyFile)},
+		{key: "auth.jwks_file", env: "JWKS_FILE", flag: "jwks-file", usage: "JSON Web Key Set file verifying bearer tokens", value: (*stringValue)(&cfg.Auth.JWT.JWKSFile)},
+		{key: "auth.jwt_issuer", env: "JWT_ISSUER", flag: "jwt-issuer", usage: "Required iss claim of bearer tokens", value: (*stringValue)(&cfg.Auth.JWT.Issuer)},
+		{key: "auth.jwt_audience", env: "JWT_AUDIENCE", flag: "jwt-audience", usage: "Required aud claim of bearer tokens", value: (*stringValue)(&cfg.Auth.JWT.Audience)},
+
+		{key: "cors.allow_origins", env: "CORS_ALLOW_ORIGINS", flag: "cors-allow-origins", usage: "Comma separated origins allowed to call the API from browsers, * for any", value: (*listValue)(&cfg.CORS.AllowOrigins)},
+		{key: "cors.allow_methods", env: "CORS_ALLOW_METHODS", flag: "cors-allow-methods", usage: "Comma separated methods allowed in cross-origin requests", value: (*listValue)(&cfg.CORS.AllowMethods)},
+		{key: "cors.allow_headers", env: "CORS_ALLOW_HEADERS", flag: "cors-allow-headers", usage: "Comma separated request headers allowed in cross-origin requests", value: (*listValue)(&cfg.CORS.AllowHeaders)},
+		{key: "cors.expose_headers", env: "CORS_EXPOSE_HEADERS", flag: "cors-expose-headers", usage: "Comma separated response headers exposed to browsers", value: (*listValue)(&cfg.CORS.ExposeHeaders)},
+		{key: "cors.allow_credentials", env: "CORS_ALLOW_CREDENTIALS", flag: "cors-allow-credentials", usage: "Allow cross-origin requests with credentials", value: (*boolValue)(&cfg.CORS.AllowCredentials)},
+		{key: "cors.max_age", env: "CORS_MAX_AGE", flag: "cors-max-age", usage: "Time browsers may cache preflight responses", value: (*durationValue)(&cfg.CORS.MaxAge)},
+
+		{key: "rate_limits.ip", env: "RATE_LIMIT_IP", flag: "rate-limit-ip", usage: "Rate limit of all requests per client IP address as <requests per second>[:<burst>]", value: (*stringValue)(&cfg.RateLimits.IP)},
+		{key: "rate_limits.read", env: "RATE_LIMIT_READ", flag: "rate-limit-read", usage: "Rate limit of read routes per client as <requests per second>[:<burst>]", value: (*stringValue)(&cfg.RateLimits.Read)},
+		{key: "rate_limits.write", env: "RATE_LIMIT_WRITE", flag: "rate-limit-write", usage: "Rate limit of write routes per client as <requests per second>[:<burst>]", value: (*stringValue)(&cfg.RateLimits.Write)},
+		{key: "rate_limits.admin", env: "RATE_LIMIT_ADMIN", flag: "rate-limit-admin", usage: "Rate limit of admin routes per client as <requests per second>[:<burst>]", value: (*stringValue)(&cfg.RateLimits.Admin)},
+		{key: "rate_limits.order_quota", env: "ORDER_QUOTA", flag: "order-quota", usage: "Orders a client may create per day", value: (*intValue)(&cfg.RateLimits.OrderQuota)},
+
+		{key: "orders.ttl", env: "ORDER_TTL", flag: "order-ttl", usage: "Time after which unchanged NEW orders expire", value: (*durationValue)(&cfg.Orders.TTL)},
+		{key: "orders.retention", env: "ORDER_RETENTION", flag: "order-retention", usage: "Time after which expired orders are purged", value: (*durationValue)(&cfg.Orders.Retention)},
+
+		{key: "audit.log", env: "AUDIT_LOG", flag: "audit-log", usage: "File to append the audit log to", value: (*stringValue)(&cfg.Audit.Log)},
+
+		{key: "tracing.exporter", env: "TRACE_EXPORTER", flag: "trace-exporter", usage: "Span exporter: none, stdout or file", value: (*stringValue)(&cfg.Tracing.Exporter)},
+		{key: "tracing.file", env: "TRACE_FILE", flag: "trace-file", usage: "File the file exporter appends spans to", value: (*stringValue)(&cfg.Tracing.File)},
+
+		{key: "log.format", env: "LOG_FORMAT", flag: "log-format", usage: "Log format: json or text", value: (*stringValue)(&cfg.Log.Format)},
+		{key: "log.level", env: "LOG_LEVEL", flag: "log-level", usage: "Log level: debug, info, warn or error", value: (*stringValue)(&cfg.Log.Level)},
+	}
+}
+
+// Load returns the configuration of the defaults overridden by the TOML file
+// named by --config or CONFIG_FILE, then the environment, then the flags in args.
+// A variable set to the empty string overrides as well: it clears a string or
+// list and sets a number, duration or boolean to zero, which disables rate
+// limits, the order quota and the order TTL. Other flags, such as
+// --print-config, can be defined on fs beforehand. Load does not validate the
+// configuration.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	getenv := func(key string) string {
+		v, _ := lookupEnv(key)
+		return v
+	}
+	cfg := Default()
+	all := settings(&cfg)
+
+	// Flags are parsed first to find the file, but set in order after it.
+	type assignment struct{ setting, value string }
+	var flagged []assignment
+	file := getenv("CONFIG_FILE")
+	fs.StringVar(&file, "config", file, "TOML configuration file")
+	for _, s := range all {
+		f := flagValue{s.value, func(v string) { flagged = append(flagged, assignment{s.flag, v}) }}
+		if _, ok := s.value.(*boolValue); ok {
+			fs.Var(&boolFlag{f}, s.flag, s.usage)
+		} else {
+			fs.Var(&f, s.flag, s.usage)
+		}
+	}
+	// --port is the flag of the listen address from before the configuration file.
+	listen := fs.Lookup("listen")
+	fs.Var(listen.Value, "port", "Alias of --listen")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg = Default()
+
+	if file != "" {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return Config{}, err
+		}
+		values, err := parseTOML(string(src))
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, s := range all {
+			if v, ok := values[s.key]; ok {
+				if err := s.value.Set(v); err != nil {
+					return Config{}, fmt.Errorf("%s: %s: %w", file, s.key, err)
+				}
+				delete(values, s.key)
+			}
+		}
+		unknown := make([]string, 0, len(values))
+		for key := range values {
+			unknown = append(unknown, key)
+		}
+		if len(unknown) > 0 {
+			slices.Sort(unknown)
+			return Config{}, fmt.Errorf("%s: unknown setting %q", file, unknown[0])
+		}
+	}
+
+	// PORT is the bare port number the API was configured with before LISTEN_ADDR.
+	if port := getenv("PORT"); port != "" {
+		cfg.Server.Listen = ":" + port
+	}
+	for _, s := range all {
+		if v, ok := lookupEnv(s.env); ok {
+			if err := s.value.Set(v); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, a := range flagged {
+		for _, s := range all {
+			if s.flag == a.setting {
+				_ = s.value.Set(a.value) // checked when parsed
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration and returns all problems found, each
+// prefixed with the key of the setting.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Listen == "" {
+		invalid("server.listen", "must not be empty")
+	}
+	for key, d := range map[string]time.Duration{
+		"server.read_timeout":     c.Server.ReadTimeout,
+		"server.write_timeout":    c.Server.WriteTimeout,
+		"server.idle_timeout":     c.Server.IdleTimeout,
+		"server.shutdown_delay":   c.Server.ShutdownDelay,
+		"server.shutdown_timeout": c.Server.ShutdownTimeout,
+		"tls.reload_interval":     c.TLS.ReloadInterval,
+		"cors.max_age":            c.CORS.MaxAge,
+		"orders.ttl":              c.Orders.TTL,
+		"orders.retention":        c.Orders.Retention,
+	} {
+		if d < 0 {
+			invalid(key, "must not be negative")
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("tls.cert_file", "tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		invalid("tls.client_ca_file", "client certificates need tls.cert_file and tls.key_file")
+	}
+	if c.TLS.ClientAuth != "optional" && c.TLS.ClientAuth != "require" {
+		invalid("tls.client_auth", "unknown mode %q, want optional or require", c.TLS.ClientAuth)
+	}
+	for _, entry := range c.TLS.ClientRoles {
+		if name, role, ok := strings.Cut(entry, "="); !ok || name == "" || !slices.Contains(auth.Roles, role) {
+			invalid("tls.client_roles", "invalid entry %q, want <common name>=<role> with role customer, cashier or admin", entry)
+		}
+	}
+
+	if c.Admin.Listen != "" && c.Admin.Listen == c.Server.Listen {
+		invalid("admin.listen", "must differ from server.listen")
+	}
+	if c.Admin.Listen == "unix:" {
+		invalid("admin.listen", "missing Unix socket path")
+	}
+	if c.Admin.Listen != "" && !strings.HasPrefix(c.Admin.Listen, "unix:") && c.Admin.APIKeys == "" && !c.Auth.Enabled() {
+		invalid("admin.listen", "a TCP listener requires admin.api_keys or authentication")
+	}
+	if c.Admin.Listen != "" && !strings.HasPrefix(c.Admin.Listen, "unix:") && c.TLS.CertFile == "" && !loopback(c.Admin.Listen) {
+		invalid("admin.listen", "a TCP listener without tls.cert_file must be on a loopback address")
+	}
+
+	if c.Store.Backend != "memory" {
+		invalid("store.backend", "unsupported backend %q, only \"memory\" is available", c.Store.Backend)
+	} else if c.Store.DSN != "" {
+		invalid("store.dsn", "not used by the memory backend")
+	}
+
+	if slices.Contains(c.CORS.AllowOrigins, "*") && c.CORS.AllowCredentials {
+		invalid("cors.allow_origins", "\"*\" cannot be combined with cors.allow_credentials")
+	}
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			invalid("cors.allow_origins", "origin %q must start with http:// or https://", origin)
+		}
+	}
+
+	for key, rule := range map[string]string{
+		"rate_limits.ip":    c.RateLimits.IP,
+		"rate_limits.read":  c.RateLimits.Read,
+		"rate_limits.write": c.RateLimits.Write,
+		"rate_limits.admin": c.RateLimits.Admin,
+	} {
+		if rule == "" {
+			continue
+		}
+		if _, err := ratelimit.ParseRule(rule); err != nil {
+			invalid(key, "%v", err)
+		}
+	}
+	if c.RateLimits.OrderQuota < 0 {
+		invalid("rate_limits.order_quota", "must not be negative")
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			invalid("tracing.file", "must not be empty with the file exporter")
+		}
+	default:
+		invalid("tracing.exporter", "unknown exporter %q, want none, stdout or file", c.Tracing.Exporter)
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		invalid("log.format", "unknown format %q, want json or text", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "unknown level %q, want debug, info, warn or error", c.Log.Level)
+	}
+
+	// Map iteration order varies, keep the report stable.
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// Print writes the configuration to w as a TOML file, with secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	var b strings.Builder
+	table := ""
+	for _, s := range settings(&c) {
+		section, key, _ := strings.Cut(s.key, ".")
+		if section != table {
+			if table != "" {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "[%s]\n", section)
+			table = section
+		}
+		v := s.value.toml()
+		if s.secret && s.value.String() != "" {
+			v = quote("REDACTED")
+		}
+		fmt.Fprintf(&b, "%s = %s\n", key, v)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// loopback reports whether the host of the TCP address is a loopback address.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, args []string, env map[string]string) (Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args, func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := writeFile(t, `
+# Settings of the file are overridden by the environment and flags.
+[server]
+listen = ":4000"
+read_timeout = "5s"
+shutdown_timeout = "10s"
+
+[cors]
+allow_origins = [
+  "https://shop.example.com", # the shop
+  'https://admin.example.com',
+]
+allow_credentials = true
+
+[rate_limits]
+order_quota = 1_000_000
+`)
+
+	cfg, err := load(t, []string{"--config", file, "--shutdown-timeout", "20s"}, map[string]string{
+		"READ_TIMEOUT": "7s",
+		"LOG_LEVEL":    "debug",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Listen != ":4000" || cfg.Server.ReadTimeout != 7*time.Second || cfg.Server.ShutdownTimeout != 20*time.Second {
+		t.Errorf("unexpected server settings: %+v", cfg.Server)
+	}
+	if strings.Join(cfg.CORS.AllowOrigins, " ") != "https://shop.example.com https://admin.example.com" || !cfg.CORS.AllowCredentials {
+		t.Errorf("unexpected CORS settings: %+v", cfg.CORS)
+	}
+	if cfg.RateLimits.OrderQuota != 1000000 || cfg.Log.Level != "debug" || cfg.Log.Format != "json" {
+		t.Errorf("unexpected settings: %+v %+v", cfg.RateLimits, cfg.Log)
+	}
+
+	// CONFIG_FILE names the file too, PORT and --port keep working.
+	cfg, err = load(t, []string{"--port", ":5000"}, map[string]string{"CONFIG_FILE": file, "PORT": "4500"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Listen != ":5000" || cfg.Server.ReadTimeout != 5*time.Second {
+		t.Errorf("unexpected server settings: %+v", cfg.Server)
+	}
+	cfg, _ = load(t, nil, map[string]string{"PORT": "4500"})
+	if cfg.Server.Listen != ":4500" {
+		t.Errorf("listen = %q, want :4500", cfg.Server.Listen)
+	}
+}
+
+// Test that empty environment variables disable the limits that are on by default.
+func TestLoadEmptyEnv(t *testing.T) {
+	env := map[string]string{"ORDER_QUOTA": "", "ORDER_TTL": ""}
+	for _, s := range []string{"RATE_LIMIT_IP", "RATE_LIMIT_READ", "RATE_LIMIT_WRITE", "RATE_LIMIT_ADMIN"} {
+		env[s] = ""
+	}
+	cfg, err := load(t, nil, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimits != (RateLimits{}) || cfg.Orders.TTL != 0 {
+		t.Errorf("limits not disabled: %+v, order TTL %s", cfg.RateLimits, cfg.Orders.TTL)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("disabled limits: %v", err)
+	}
+
+	// Unset variables keep the defaults.
+	cfg, err = load(t, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimits != Default().RateLimits || cfg.Orders.TTL != Default().Orders.TTL {
+		t.Errorf("defaults changed: %+v, order TTL %s", cfg.RateLimits, cfg.Orders.TTL)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		file, args string
+		env        map[string]string
+		want       string
+	}{
+		{file: "[server]\nlisten = :3000", want: `line 2 (last key "server.listen")`},
+		{file: "[server]\nread_timeout = \"soon\"", want: `server.read_timeout: invalid duration "soon"`},
+		{file: "[server]\nlisten = \":1\"\nlisten = \":2\"", want: `line 3 (last key "server.listen")`},
+		{file: "[server]\nport = 3000", want: `unknown setting "server.port"`},
+		{file: "[cors]\nallow_origins = [\"a\"", want: `line 2 (last key "cors.allow_origins")`},
+		{file: "[server\n", want: `to end table name`},
+		{file: "[rate_limits]\norder_quota = 1.5", want: `rate_limits.order_quota: unsupported value 1.5`},
+		{file: "[cors]\nallow_origins = [[\"a\"]]", want: `cors.allow_origins: nested arrays are not supported`},
+		{env: map[string]string{"ORDER_QUOTA": "many"}, want: `ORDER_QUOTA: invalid integer "many"`},
+		{args: "--order-ttl=1 day", want: `invalid value "1 day" for flag -order-ttl`},
+	} {
+		var args []string
+		if tc.args != "" {
+			args = []string{tc.args}
+		}
+		if tc.file != "" {
+			args = append(args, "--config", writeFile(t, tc.file))
+		}
+		_, err := load(t, args, tc.env)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("error = %v, want %q", err, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default configuration invalid: %v", err)
+	}
+
+	cfg := Default()
+	cfg.Server.Listen = ""
+	cfg.Admin.Listen = "unix:"
+	cfg.Server.ShutdownTimeout = -time.Second
+	cfg.TLS.KeyFile = "tls.key"
+	cfg.TLS.ClientRoles = []string{"billing=root"}
+	cfg.Store.Backend = "postgres"
+	cfg.CORS.AllowOrigins = []string{"*", "shop.example.com"}
+	cfg.CORS.AllowCredentials = true
+	cfg.RateLimits.Write = "fast"
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.Log.Level = "verbose"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"server.listen: must not be empty",
+		"server.shutdown_timeout: must not be negative",
+		"admin.listen: missing Unix socket path",
+		"tls.cert_file: tls.cert_file and tls.key_file must be set together",
+		`tls.client_roles: invalid entry "billing=root"`,
+		`store.backend: unsupported backend "postgres"`,
+		`cors.allow_origins: "*" cannot be combined with cors.allow_credentials`,
+		`cors.allow_origins: origin "shop.example.com" must start with http:// or https://`,
+		"rate_limits.write:",
+		`tracing.exporter: unknown exporter "jaeger"`,
+		`log.level: unknown level "verbose"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+
+	// The admin listener is only open without authentication on a Unix socket.
+	cfg = Default()
+	cfg.Admin.Listen = "127.0.0.1:9090"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "admin.listen: a TCP listener requires") {
+		t.Errorf("TCP admin listener without authentication: got %v", err)
+	}
+	cfg.Auth.JWT.HMACSecret = "secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("TCP admin listener with authentication: %v", err)
+	}
+	// Without TLS a TCP admin listener must not be reachable from other hosts.
+	for _, addr := range []string{":9090", "0.0.0.0:9090", "10.0.0.5:9090", "admin.example.com:9090"} {
+		cfg.Admin.Listen = addr
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "admin.listen: a TCP listener without tls.cert_file") {
+			t.Errorf("TCP admin listener on %s without TLS: got %v", addr, err)
+		}
+	}
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = "tls.crt", "tls.key"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("TCP admin listener with TLS: %v", err)
+	}
+	cfg = Default()
+	cfg.Admin.Listen = "unix:/run/api/admin.sock"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("admin socket without authentication: %v", err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWT.HMACSecret = "s3cret"
+	cfg.CORS.AllowOrigins = []string{"https://shop.example.com"}
+
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "s3cret") || !strings.Contains(printed, `jwt_secret = "REDACTED"`) {
+		t.Errorf("secret not redacted:\n%s", printed)
+	}
+	if !strings.Contains(printed, `dsn = ""`) {
+		t.Errorf("empty secret redacted:\n%s", printed)
+	}
+
+	// The printed configuration loads back, but for the redacted secret.
+	loaded, err := load(t, []string{"--config", writeFile(t, printed)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Auth.JWT.HMACSecret = cfg.Auth.JWT.HMACSecret
+	var again strings.Builder
+	_ = loaded.Print(&again)
+	if again.String() != printed {
+		t.Errorf("printed configuration changed when loaded:\n%s\nwant:\n%s", again.String(), printed)
+	}
+}
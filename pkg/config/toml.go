@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML parses a TOML configuration file and returns its values by dotted
+// key, as "table.key", in their flag form: arrays are joined by commas.
+func parseTOML(src string) (map[string]string, error) {
+	var doc map[string]any
+	if _, err := toml.Decode(src, &doc); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	if err := flatten(values, "", doc); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// flatten adds the values of the table to values, with their keys prefixed.
+func flatten(values map[string]string, prefix string, table map[string]any) error {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		v := table[key]
+		key = prefix + key
+		if sub, ok := v.(map[string]any); ok {
+			if err := flatten(values, key+".", sub); err != nil {
+				return err
+			}
+			continue
+		}
+		s, err := flagForm(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = s
+	}
+	return nil
+}
+
+// flagForm returns a string, integer, boolean or array of them in its flag form.
+func flagForm(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.([]any); ok {
+				return "", fmt.Errorf("nested arrays are not supported")
+			}
+			s, err := flagForm(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v, want a string, integer, boolean or array", v)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// value is a setting parsed from its flag form, the form used by the file and
+// the environment too, and printed in its TOML form.
+type value interface {
+	String() string
+	Set(string) error
+	toml() string
+}
+
+type stringValue string
+
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) toml() string       { return quote(string(*v)) }
+
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *intValue) toml() string   { return v.String() }
+
+func (v *intValue) Set(s string) error {
+	if s == "" {
+		*v = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+type boolValue bool
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) toml() string   { return v.String() }
+
+func (v *boolValue) Set(s string) error {
+	if s == "" {
+		*v = false
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+func (v *durationValue) toml() string   { return quote(v.String()) }
+
+func (v *durationValue) Set(s string) error {
+	if s == "" {
+		*v = 0
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, want a number with a unit such as 30s or 5m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+// listValue is a comma separated list.
+type listValue []string
+
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+func (v *listValue) Set(s string) error {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v = list
+	return nil
+}
+
+func (v *listValue) toml() string {
+	items := make([]string, len(*v))
+	for i, item := range *v {
+		items[i] = quote(item)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// flagValue is the flag of a setting. It checks and sets the value when the
+// flags are parsed and reports it to set, so it can be set again after the
+// file and the environment.
+type flagValue struct {
+	value
+	set func(string)
+}
+
+// String is also called on the zero flagValue, to tell whether the default is printed.
+func (f *flagValue) String() string {
+	if f == nil || f.value == nil {
+		return ""
+	}
+	return f.value.String()
+}
+
+func (f *flagValue) Set(s string) error {
+	if err := f.value.Set(s); err != nil {
+		return err
+	}
+	f.set(s)
+	return nil
+}
+
+// boolFlag is the flag of a boolean setting, given without a value.
+type boolFlag struct {
+	flagValue
+}
+
+func (f *boolFlag) IsBoolFlag() bool { return true }
+
+func (f *boolFlag) String() string {
+	if f == nil || f.value == nil {
+		return "false"
+	}
+	return f.value.String()
+}
+
+// quote returns s as a TOML basic string.
+func quote(s string) string {
+	return strconv.Quote(s)
+}
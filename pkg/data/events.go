@@ -0,0 +1,156 @@
+package data
+
+import (
+	"slices"
+
+	"awesomeProject/pkg/events"
+)
+
+// Events is the bus order events are published on once the changed order is stored.
+var Events = events.NewBus()
+
+// Order event names.
+const (
+	EventOrderCreated           = "order.created"
+	EventOrderStatusChanged     = "order.status_changed"
+	EventOrderPaid              = "order.paid"
+	EventOrderExpired           = "order.expired"
+	EventProductAdded           = "order.product_added"
+	EventProductQuantityChanged = "order.product_quantity_changed"
+	EventProductReplaced        = "order.product_replaced"
+	EventReplacementUndone      = "order.replacement_undone"
+	EventProductReturned        = "order.product_returned"
+	EventPaymentRecorded        = "order.payment_recorded"
+	EventRefundCreated          = "order.refund_created"
+	EventRefundUpdated          = "order.refund_updated"
+)
+
+// EventNames lists all order event names.
+var EventNames = []string{
+	EventOrderCreated,
+	EventOrderStatusChanged,
+	EventOrderPaid,
+	EventOrderExpired,
+	EventProductAdded,
+	EventProductQuantityChanged,
+	EventProductReplaced,
+	EventReplacementUndone,
+	EventProductReturned,
+	EventPaymentRecorded,
+	EventRefundCreated,
+	EventRefundUpdated,
+}
+
+type OrderCreated struct {
+	OrderID string `json:"order_id"`
+}
+
+type OrderStatusChanged struct {
+	OrderID string `json:"order_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+type OrderPaid struct {
+	OrderID string `json:"order_id"`
+	Amount  Amount `json:"amount"`
+}
+
+type OrderExpired struct {
+	OrderID string `json:"order_id"`
+}
+
+type ProductAdded struct {
+	OrderID string       `json:"order_id"`
+	Product OrderProduct `json:"product"`
+}
+
+type ProductQuantityChanged struct {
+	OrderID  string `json:"order_id"`
+	LineID   string `json:"line_id"`
+	Quantity int    `json:"quantity"`
+}
+
+type ProductReplaced struct {
+	OrderID     string      `json:"order_id"`
+	LineID      string      `json:"line_id"`
+	Replacement Replacement `json:"replacement"`
+}
+
+type ReplacementUndone struct {
+	OrderID     string      `json:"order_id"`
+	LineID      string      `json:"line_id"`
+	Replacement Replacement `json:"replacement"`
+}
+
+type ProductReturned struct {
+	OrderID  string `json:"order_id"`
+	LineID   string `json:"line_id"`
+	Quantity int    `json:"quantity"`
+}
+
+type PaymentRecorded struct {
+	OrderID string  `json:"order_id"`
+	Payment Payment `json:"payment"`
+}
+
+type RefundCreated struct {
+	OrderID string `json:"order_id"`
+	Refund  Refund `json:"refund"`
+}
+
+type RefundUpdated struct {
+	OrderID string `json:"order_id"`
+	Refund  Refund `json:"refund"`
+}
+
+func (e OrderCreated) Name() string                  { return EventOrderCreated }
+func (e OrderStatusChanged) Name() string            { return EventOrderStatusChanged }
+func (e OrderPaid) Name() string                     { return EventOrderPaid }
+func (e OrderExpired) Name() string                  { return EventOrderExpired }
+func (e ProductAdded) Name() string                  { return EventProductAdded }
+func (e ProductQuantityChanged) Name() string        { return EventProductQuantityChanged }
+func (e ProductReplaced) Name() string               { return EventProductReplaced }
+func (e ReplacementUndone) Name() string             { return EventReplacementUndone }
+func (e ProductReturned) Name() string               { return EventProductReturned }
+func (e PaymentRecorded) Name() string               { return EventPaymentRecorded }
+func (e RefundCreated) Name() string                 { return EventRefundCreated }
+func (e RefundUpdated) Name() string                 { return EventRefundUpdated }
+func (e OrderCreated) AggregateID() string           { return e.OrderID }
+func (e OrderStatusChanged) AggregateID() string     { return e.OrderID }
+func (e OrderPaid) AggregateID() string              { return e.OrderID }
+func (e OrderExpired) AggregateID() string           { return e.OrderID }
+func (e ProductAdded) AggregateID() string           { return e.OrderID }
+func (e ProductQuantityChanged) AggregateID() string { return e.OrderID }
+func (e ProductReplaced) AggregateID() string        { return e.OrderID }
+func (e ReplacementUndone) AggregateID() string      { return e.OrderID }
+func (e ProductReturned) AggregateID() string        { return e.OrderID }
+func (e PaymentRecorded) AggregateID() string        { return e.OrderID }
+func (e RefundCreated) AggregateID() string          { return e.OrderID }
+func (e RefundUpdated) AggregateID() string          { return e.OrderID }
+
+// Record queues events describing a change of the order. They are published by
+// SaveOrder, so the events of a change that is never stored are dropped with it.
+func (o *Order) Record(evs ...events.Event) {
+	o.pending = append(o.pending, evs...)
+}
+
+// Recorded returns the events recorded on the order and not yet published.
+func (o Order) Recorded() []events.Event {
+	return slices.Clone(o.pending)
+}
+
+// SetStatus changes the status of the order.
+func SetStatus(order *Order, status string) {
+	if order.Status == status {
+		return
+	}
+	order.Record(OrderStatusChanged{OrderID: order.ID, From: order.Status, To: status})
+	order.Status = status
+	switch status {
+	case StatusPaid:
+		order.Record(OrderPaid{OrderID: order.ID, Amount: order.Amount})
+	case StatusExpired:
+		order.Record(OrderExpired{OrderID: order.ID})
+	}
+}
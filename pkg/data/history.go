@@ -0,0 +1,213 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// HistoryEvent is one stored change of an order. Changes is an RFC 7386 merge
+// patch turning the previous state of the order into the new one, so folding
+// all events of an order from an empty document rebuilds the order.
+type HistoryEvent struct {
+	Version int             `json:"version"`
+	Events  []string        `json:"events"`
+	Time    time.Time       `json:"time"`
+	Changes json.RawMessage `json:"changes"`
+}
+
+// history is the append-only event log of every order.
+var history = struct {
+	sync.Mutex
+	events map[string][]HistoryEvent
+	// states caches the folded state of each order as a JSON document.
+	states map[string]map[string]any
+}{
+	events: make(map[string][]HistoryEvent),
+	states: make(map[string]map[string]any),
+}
+
+// ErrConflict is returned by SaveOrderIfUnchanged when the order was changed after it was loaded.
+var ErrConflict = errors.New("order changed concurrently")
+
+// SaveOrder appends the change of the order to its history, stores the order
+// folded from the history and publishes the recorded events.
+func SaveOrder(order Order) {
+	_ = saveOrder(order, false)
+}
+
+// SaveOrderIfUnchanged saves the order like SaveOrder unless another change
+// was stored since the order was loaded, in which case it returns ErrConflict.
+func SaveOrderIfUnchanged(order Order) error {
+	return saveOrder(order, true)
+}
+
+func saveOrder(order Order, checkVersion bool) error {
+	pending := order.pending
+	order.pending = nil
+
+	names := make([]string, len(pending))
+	for i, ev := range pending {
+		names[i] = ev.Name()
+	}
+
+	history.Lock()
+	if checkVersion && len(history.events[order.ID]) != order.version {
+		history.Unlock()
+		return ErrConflict
+	}
+	stored := order
+	if doc, err := toDocument(order); err == nil {
+		prev := history.states[order.ID]
+		if changes := diffMergePatch(prev, doc); len(changes) > 0 || len(names) > 0 {
+			raw, _ := json.Marshal(changes)
+			events := history.events[order.ID]
+			history.events[order.ID] = append(events, HistoryEvent{
+				Version: len(events) + 1,
+				Events:  names,
+				Time:    time.Now().UTC(),
+				Changes: raw,
+			})
+			history.states[order.ID] = applyMergePatch(prev, changes)
+		}
+		if folded, err := fromDocument(history.states[order.ID]); err == nil {
+			stored = folded
+		}
+	}
+	stored.version = len(history.events[order.ID])
+	Orders.Store(order.ID, stored)
+	history.Unlock()
+
+	Events.Publish(pending...)
+	return nil
+}
+
+// OrderHistory returns the stored changes of an order, oldest first.
+func OrderHistory(orderID string) ([]HistoryEvent, bool) {
+	history.Lock()
+	defer history.Unlock()
+	events, ok := history.events[orderID]
+	return append([]HistoryEvent(nil), events...), ok
+}
+
+// LastModified returns the time of the last stored change of an order.
+func LastModified(orderID string) (time.Time, bool) {
+	history.Lock()
+	defer history.Unlock()
+	events := history.events[orderID]
+	if len(events) == 0 {
+		return time.Time{}, false
+	}
+	return events[len(events)-1].Time, true
+}
+
+// StoreSize returns the number of stored orders and of their history events.
+func StoreSize() (orders, events int) {
+	history.Lock()
+	defer history.Unlock()
+	for _, e := range history.events {
+		events += len(e)
+	}
+	return len(history.events), events
+}
+
+// DeleteOrder removes an order and its history.
+func DeleteOrder(orderID string) {
+	history.Lock()
+	defer history.Unlock()
+	Orders.Delete(orderID)
+	delete(history.events, orderID)
+	delete(history.states, orderID)
+}
+
+// OrderAsOf rebuilds an order as it was at the given time by folding its
+// changes up to then. It reports false if the order did not exist yet.
+func OrderAsOf(orderID string, at time.Time) (Order, bool) {
+	history.Lock()
+	events := history.events[orderID]
+	history.Unlock()
+
+	var doc map[string]any
+	for _, ev := range events {
+		if ev.Time.After(at) {
+			break
+		}
+		var changes map[string]any
+		if err := json.Unmarshal(ev.Changes, &changes); err != nil {
+			return Order{}, false
+		}
+		doc = applyMergePatch(doc, changes)
+	}
+	if doc == nil {
+		return Order{}, false
+	}
+
+	order, err := fromDocument(doc)
+	return order, err == nil
+}
+
+func toDocument(order Order) (map[string]any, error) {
+	raw, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	err = json.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+func fromDocument(doc map[string]any) (Order, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return Order{}, err
+	}
+	var order Order
+	err = json.Unmarshal(raw, &order)
+	return order, err
+}
+
+// diffMergePatch returns the merge patch turning a into b. Arrays are replaced as a whole.
+func diffMergePatch(a, b map[string]any) map[string]any {
+	patch := make(map[string]any)
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, bv := range b {
+		av, ok := a[key]
+		if ok && reflect.DeepEqual(av, bv) {
+			continue
+		}
+		aObj, aIsObj := av.(map[string]any)
+		bObj, bIsObj := bv.(map[string]any)
+		if ok && aIsObj && bIsObj {
+			patch[key] = diffMergePatch(aObj, bObj)
+			continue
+		}
+		patch[key] = bv
+	}
+	return patch
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to a copy of doc.
+func applyMergePatch(doc, patch map[string]any) map[string]any {
+	result := make(map[string]any, len(doc))
+	for key, value := range doc {
+		result[key] = value
+	}
+	for key, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(result, key)
+		case map[string]any:
+			current, _ := result[key].(map[string]any)
+			result[key] = applyMergePatch(current, value)
+		default:
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -1,13 +1,6 @@
 package data
 
-import (
-	"encoding/json"
-	"fmt"
-	"math"
-	"strconv"
-
-	"github.com/google/uuid"
-)
+import "awesomeProject/pkg/events"
 
 type OrderProduct struct {
 	ID           string        `json:"id"`
@@ -16,6 +9,11 @@ type OrderProduct struct {
 	ProductID    int           `json:"product_id"`
 	Quantity     int           `json:"quantity"`
 	ReplacedWith *OrderProduct `json:"replaced_with"`
+	// Replacements is the replacement chain of the line, oldest first.
+	// ReplacedWith always mirrors its last element.
+	Replacements []Replacement `json:"replacements,omitempty"`
+	// ReturnedQuantity counts items of this line returned after payment.
+	ReturnedQuantity int `json:"returned_quantity,omitempty"`
 }
 
 type Amount struct {
@@ -26,18 +24,36 @@ type Amount struct {
 }
 
 type Order struct {
-	Amount   Amount         `json:"amount"`
-	ID       string         `json:"id"`
+	Amount Amount `json:"amount"`
+	ID     string `json:"id"`
+	// Owner is the principal that created the order, if authenticated, as
+	// "<authentication method>:<subject>".
+	Owner    string         `json:"owner,omitempty"`
 	Products []OrderProduct `json:"products"`
+	Payments []Payment      `json:"payments,omitempty"`
+	Refunds  []Refund       `json:"refunds,omitempty"`
 	Status   string         `json:"status"`
+
+	// pending holds the recorded events not yet published by SaveOrder.
+	pending []events.Event
+	// version is the number of history events of the order when it was loaded.
+	version int
 }
 
+// Order statuses.
+const (
+	StatusNew  = "NEW"
+	StatusPaid = "PAID"
+	// StatusExpired is set on NEW orders abandoned for too long; they can no longer change.
+	StatusExpired = "EXPIRED"
+)
+
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status"`
 }
 
 func NewOrder(orderID string) Order {
-	return Order{
+	order := Order{
 		Amount: Amount{
 			Discount: "0.00",
 			Paid:     "0.00",
@@ -47,8 +63,32 @@ func NewOrder(orderID string) Order {
 		ID: orderID,
 
 		Products: []OrderProduct{},
-		Status:   "NEW",
+		Status:   StatusNew,
+	}
+	order.Record(OrderCreated{OrderID: orderID})
+	return order
+}
+
+// Clone returns a deep copy of the order, so it can be changed without
+// affecting the value stored in Orders until it is stored again.
+func (o Order) Clone() Order {
+	clone := o
+	clone.Products = make([]OrderProduct, len(o.Products))
+	for i, product := range o.Products {
+		if product.ReplacedWith != nil {
+			replacedWith := *product.ReplacedWith
+			product.ReplacedWith = &replacedWith
+		}
+		product.Replacements = append([]Replacement(nil), product.Replacements...)
+		clone.Products[i] = product
+	}
+	clone.Payments = append([]Payment(nil), o.Payments...)
+	clone.Refunds = append([]Refund(nil), o.Refunds...)
+	for i, refund := range clone.Refunds {
+		clone.Refunds[i].Parts = append([]RefundPart(nil), refund.Parts...)
 	}
+	clone.pending = append([]events.Event(nil), o.pending...)
+	return clone
 }
 
 type UpdateProductQuantityRequest struct {
@@ -61,71 +101,3 @@ type UpdateProductRequest struct {
 		Quantity  int `json:"quantity"`
 	} `json:"replaced_with"`
 }
-
-func UpdateProduct(order *Order, productID string, replacementProductID int, quantity int) (string, bool) {
-	for i, product := range order.Products {
-		if product.ID == productID {
-			for _, globalProduct := range Products {
-				if globalProduct.ID == replacementProductID {
-					order.Products[i].ReplacedWith = &OrderProduct{
-						ID:           uuid.New().String(),
-						ProductID:    globalProduct.ID,
-						Name:         globalProduct.Name,
-						Price:        globalProduct.Price,
-						Quantity:     quantity,
-						ReplacedWith: nil,
-					}
-					x := []OrderProduct{*order.Products[i].ReplacedWith}
-					return calculateTotal(x), true
-				}
-			}
-			break
-		}
-	}
-	return "", false
-}
-
-func UpdateOrderAmount(order *Order, oldTotal string, newTotal string) {
-	f64Old, _ := strconv.ParseFloat(oldTotal, 64)
-	f64New, _ := strconv.ParseFloat(newTotal, 64)
-	diff := f64Old - f64New
-
-	if diff > 0 {
-		order.Amount.Returns = strconv.FormatFloat(math.Abs(diff), 'f', 2, 64)
-		order.Amount.Total = strconv.FormatFloat(f64New, 'f', 2, 64)
-
-	} else if diff < 0 {
-		order.Amount.Discount = strconv.FormatFloat(math.Abs(diff), 'f', 2, 64)
-	}
-}
-
-// CalculateTotal Helper function to calculate the total amount of the order,
-// including the amount and quantity of any replaced products.
-func calculateTotal(products []OrderProduct) string {
-	total := 0.0
-	for _, product := range products {
-		price, _ := strconv.ParseFloat(product.Price, 64)
-		total += price * float64(product.Quantity)
-
-		// Check if the product has a replaced_with field and it's not null
-		if product.ReplacedWith != nil {
-			// Convert the replaced_with struct to a JSON byte slice
-			replacedWithBytes, err := json.Marshal(product.ReplacedWith)
-			if err != nil {
-				// Handle error
-				continue
-			}
-
-			// Unmarshal the JSON byte slice into a map
-			var replacedWith map[string]interface{}
-			if err := json.Unmarshal(replacedWithBytes, &replacedWith); err == nil {
-				if amount, ok := replacedWith["amount"].(float64); ok {
-					if quantity, ok := replacedWith["quantity"].(float64); ok {
-						total += amount * quantity
-					}
-				}
-			}
-		}
-	}
-	return fmt.Sprintf("%.2f", total)
-}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment methods accepted for an order.
+const (
+	PaymentMethodCash         = "cash"
+	PaymentMethodCard         = "card"
+	PaymentMethodBankTransfer = "bank_transfer"
+	// PaymentMethodManual is recorded when an order is marked PAID directly.
+	PaymentMethodManual = "manual"
+)
+
+var (
+	ErrInvalidAmount        = errors.New("invalid amount")
+	ErrInvalidPaymentMethod = errors.New("invalid payment method")
+	ErrOverpayment          = errors.New("payment exceeds outstanding amount")
+	ErrOrderPaid            = errors.New("order is already paid")
+)
+
+// Payment is a single amount of money received towards an order.
+type Payment struct {
+	ID        string `json:"id"`
+	Amount    string `json:"amount"`
+	Method    string `json:"method"`
+	Reference string `json:"reference"`
+	// ProviderRef is the capture transaction ID at the payment provider, if any.
+	ProviderRef string    `json:"provider_ref,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type AddPaymentRequest struct {
+	Amount    string `json:"amount"`
+	Method    string `json:"method"`
+	Reference string `json:"reference"`
+}
+
+// CheckPayment validates a payment against the order without recording it.
+func CheckPayment(order Order, amount, method string) error {
+	if order.Status == StatusPaid {
+		return ErrOrderPaid
+	}
+
+	switch method {
+	case PaymentMethodCash, PaymentMethodCard, PaymentMethodBankTransfer, PaymentMethodManual:
+	default:
+		return ErrInvalidPaymentMethod
+	}
+
+	cents, err := parseCents(amount)
+	if err != nil || cents <= 0 {
+		return ErrInvalidAmount
+	}
+	if cents > OutstandingCents(order) {
+		return ErrOverpayment
+	}
+	return nil
+}
+
+// AddPayment records a payment on the order, recomputes Amount.Paid as the sum
+// of all payments and moves the order to PAID once the total is covered.
+func AddPayment(order *Order, payment Payment) (Payment, error) {
+	if err := CheckPayment(*order, payment.Amount, payment.Method); err != nil {
+		return Payment{}, err
+	}
+
+	cents, _ := parseCents(payment.Amount)
+	payment.ID = uuid.New().String()
+	payment.Amount = FormatCents(cents)
+	payment.CreatedAt = time.Now().UTC()
+	order.Payments = append(order.Payments, payment)
+	order.Record(PaymentRecorded{OrderID: order.ID, Payment: payment})
+
+	paid := paidCents(*order)
+	order.Amount.Paid = FormatCents(paid)
+	if total, _ := parseCents(order.Amount.Total); paid >= total {
+		SetStatus(order, StatusPaid)
+	}
+
+	return payment, nil
+}
+
+// OutstandingCents returns the part of the order total that is not paid yet.
+func OutstandingCents(order Order) int64 {
+	total, _ := parseCents(order.Amount.Total)
+	if outstanding := total - paidCents(order); outstanding > 0 {
+		return outstanding
+	}
+	return 0
+}
+
+func paidCents(order Order) int64 {
+	var paid int64
+	for _, payment := range order.Payments {
+		cents, _ := parseCents(payment.Amount)
+		paid += cents
+	}
+	return paid
+}
+
+// moneyFormat is the format of money amounts: euros and exactly two decimals of cents.
+// Fifteen digits of euros keep every amount within the range of int64 cents.
+var moneyFormat = regexp.MustCompile(`^\d{1,15}\.\d{2}$`)
+
+// parseCents converts a decimal money string such as "12.34" into cents.
+// Other formats, such as "12.345", "1e2" or " 5", are rejected rather than rounded.
+func parseCents(amount string) (int64, error) {
+	if !moneyFormat.MatchString(amount) {
+		return 0, ErrInvalidAmount
+	}
+	euros, cents, _ := strings.Cut(amount, ".")
+	e, _ := strconv.ParseInt(euros, 10, 64)
+	c, _ := strconv.ParseInt(cents, 10, 64)
+	return e*100 + c, nil
+}
+
+// FormatCents formats an amount in cents as a decimal money string.
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
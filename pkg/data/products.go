@@ -1,6 +1,17 @@
 package data
 
-import "sync"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"awesomeProject/pkg/buildinfo"
+)
 
 type Product struct {
 	ID    int    `json:"id"`
@@ -8,12 +19,165 @@ type Product struct {
 	Price string `json:"price"`
 }
 
-var (
-	Products = []Product{
+var Orders = sync.Map{}
+
+// catalog holds the products that can be ordered. It is changed by the catalog
+// admin while orders are served, so it is only accessed through the functions below.
+// Every change bumps its version and modification time. The built-in catalog was
+// last modified with the build, a catalog file when the file was.
+var catalog = struct {
+	sync.RWMutex
+	products []Product
+	version  uint64
+	modified time.Time
+}{
+	version:  1,
+	modified: buildTime(),
+	products: []Product{
 		{ID: 123, Name: "Ketchup", Price: "0.45"},
 		{ID: 456, Name: "Beer", Price: "2.33"},
 		{ID: 879, Name: "Õllesnäkk", Price: "0.42"},
 		{ID: 999, Name: "75\" OLED TV", Price: "1333.37"},
+	},
+}
+
+var ErrInvalidProduct = errors.New("invalid product")
+
+// Products returns the catalog.
+func Products() []Product {
+	catalog.RLock()
+	defer catalog.RUnlock()
+	return slices.Clone(catalog.products)
+}
+
+// VersionedProducts returns the catalog with its version and the time it last changed.
+func VersionedProducts() ([]Product, uint64, time.Time) {
+	catalog.RLock()
+	defer catalog.RUnlock()
+	return slices.Clone(catalog.products), catalog.version, catalog.modified
+}
+
+// FindProduct looks up a catalog product by ID.
+func FindProduct(id int) (Product, bool) {
+	catalog.RLock()
+	defer catalog.RUnlock()
+	for _, product := range catalog.products {
+		if product.ID == id {
+			return product, true
+		}
 	}
-	Orders = sync.Map{}
-)
+	return Product{}, false
+}
+
+// SetProducts replaces the catalog.
+func SetProducts(products []Product) error {
+	return setProducts(products, time.Now())
+}
+
+func setProducts(products []Product, modified time.Time) error {
+	seen := make(map[int]bool)
+	for _, product := range products {
+		if err := validateProduct(product); err != nil {
+			return err
+		}
+		if seen[product.ID] {
+			return fmt.Errorf("%w: duplicate id %d", ErrInvalidProduct, product.ID)
+		}
+		seen[product.ID] = true
+	}
+
+	catalog.Lock()
+	defer catalog.Unlock()
+	catalog.products = slices.Clone(products)
+	catalog.version++
+	catalog.modified = modified
+	return nil
+}
+
+// PutProduct adds the product to the catalog or replaces the product with its ID.
+// It reports whether the product was added. Orders keep the name and price their
+// lines were added with.
+func PutProduct(product Product) (bool, error) {
+	if err := validateProduct(product); err != nil {
+		return false, err
+	}
+
+	catalog.Lock()
+	defer catalog.Unlock()
+	for i := range catalog.products {
+		if catalog.products[i].ID == product.ID {
+			catalog.products[i] = product
+			catalogChanged()
+			return false, nil
+		}
+	}
+	catalog.products = append(catalog.products, product)
+	catalogChanged()
+	return true, nil
+}
+
+// DeleteProduct removes the product from the catalog and reports whether it was there.
+func DeleteProduct(id int) bool {
+	catalog.Lock()
+	defer catalog.Unlock()
+	i := slices.IndexFunc(catalog.products, func(p Product) bool { return p.ID == id })
+	if i < 0 {
+		return false
+	}
+	catalog.products = slices.Delete(catalog.products, i, i+1)
+	catalogChanged()
+	return true
+}
+
+// buildTime returns the build time of the binary, or the zero time if it is unknown.
+func buildTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, buildinfo.Get().BuildTime)
+	return t
+}
+
+// catalogChanged bumps the catalog version. The catalog must be locked.
+func catalogChanged() {
+	catalog.version++
+	catalog.modified = time.Now()
+}
+
+// priceFormat is the money format of catalog prices: at most nine digits of euros, which keeps
+// order amounts exact in cents, and exactly two decimals.
+var priceFormat = regexp.MustCompile(`^\d{1,9}\.\d{2}$`)
+
+func validateProduct(product Product) error {
+	if product.ID <= 0 {
+		return fmt.Errorf("%w: id %d", ErrInvalidProduct, product.ID)
+	}
+	if product.Name == "" {
+		return fmt.Errorf("%w: product %d has no name", ErrInvalidProduct, product.ID)
+	}
+	if !priceFormat.MatchString(product.Price) {
+		return fmt.Errorf("%w: price %q of product %d", ErrInvalidProduct, product.Price, product.ID)
+	}
+	return nil
+}
+
+// LoadProducts replaces the catalog with the JSON array of products in the file.
+// The catalog was last modified when the file was.
+func LoadProducts(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var products []Product
+	if err := json.Unmarshal(raw, &products); err != nil {
+		return fmt.Errorf("catalog %s: %w", path, err)
+	}
+	if len(products) == 0 {
+		return fmt.Errorf("catalog %s: no products", path)
+	}
+	if err := setProducts(products, info.ModTime()); err != nil {
+		return fmt.Errorf("catalog %s: %w", path, err)
+	}
+	return nil
+}
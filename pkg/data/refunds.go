@@ -0,0 +1,183 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refund states. Only issued refunds count towards Amount.Returns.
+const (
+	RefundPending = "pending"
+	RefundIssued  = "issued"
+	RefundFailed  = "failed"
+)
+
+// Refund sources.
+const (
+	RefundSourceReplacement = "replacement"
+	RefundSourceManual      = "manual"
+	RefundSourceReturn      = "return"
+)
+
+var (
+	ErrRefundNotFound  = errors.New("refund not found")
+	ErrOverRefund      = errors.New("refund exceeds refundable amount")
+	ErrOrderNotPaid    = errors.New("order is not paid")
+	ErrInvalidRefundOp = errors.New("invalid refund state transition")
+)
+
+// Refund is money owed back to the customer of a paid order.
+type Refund struct {
+	ID     string `json:"id"`
+	Amount string `json:"amount"`
+	Reason string `json:"reason"`
+	Source string `json:"source"`
+	Status string `json:"status"`
+	// ProviderRef is the refund transaction ID at the payment provider of the first part, if any.
+	ProviderRef string `json:"provider_ref,omitempty"`
+	// Parts are the shares of the refund returned through the provider captures of
+	// the order. What they do not cover was paid in cash and is returned at the till.
+	Parts     []RefundPart `json:"parts,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// RefundPart is the share of a refund returned through one capture.
+type RefundPart struct {
+	CaptureID string `json:"capture_id"`
+	Amount    string `json:"amount"`
+	// ProviderRef is the refund transaction ID once the provider returned the part.
+	ProviderRef string `json:"provider_ref,omitempty"`
+}
+
+type AddRefundRequest struct {
+	Amount string `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// AddRefund records a pending refund on a paid order.
+func AddRefund(order *Order, amount, source, reason string) (Refund, error) {
+	if order.Status != StatusPaid {
+		return Refund{}, ErrOrderNotPaid
+	}
+
+	cents, err := parseCents(amount)
+	if err != nil || cents <= 0 {
+		return Refund{}, ErrInvalidAmount
+	}
+	if cents > RefundableCents(*order) {
+		return Refund{}, ErrOverRefund
+	}
+
+	refund := Refund{
+		ID:        uuid.New().String(),
+		Amount:    FormatCents(cents),
+		Reason:    reason,
+		Source:    source,
+		Status:    RefundPending,
+		Parts:     refundParts(*order, cents),
+		CreatedAt: time.Now().UTC(),
+	}
+	order.Refunds = append(order.Refunds, refund)
+	order.Record(RefundCreated{OrderID: order.ID, Refund: refund})
+	return refund, nil
+}
+
+// refundParts splits a refund across the provider captures of the order, newest
+// first, up to what each capture has left after the parts of earlier refunds.
+func refundParts(order Order, cents int64) []RefundPart {
+	allocated := make(map[string]int64)
+	for _, refund := range order.Refunds {
+		for _, part := range refund.Parts {
+			if refund.Status == RefundPending || (refund.Status == RefundIssued && part.ProviderRef != "") {
+				amount, _ := parseCents(part.Amount)
+				allocated[part.CaptureID] += amount
+			}
+		}
+	}
+
+	var parts []RefundPart
+	for i := len(order.Payments) - 1; i >= 0 && cents > 0; i-- {
+		payment := order.Payments[i]
+		if payment.ProviderRef == "" {
+			continue
+		}
+		captured, _ := parseCents(payment.Amount)
+		share := min(captured-allocated[payment.ProviderRef], cents)
+		if share <= 0 {
+			continue
+		}
+		parts = append(parts, RefundPart{CaptureID: payment.ProviderRef, Amount: FormatCents(share)})
+		cents -= share
+	}
+	return parts
+}
+
+// SetRefundPartRef records the provider transaction of a returned part of a pending refund.
+func SetRefundPartRef(order *Order, refundID string, part int, providerRef string) (Refund, error) {
+	for i, refund := range order.Refunds {
+		if refund.ID != refundID {
+			continue
+		}
+		if refund.Status != RefundPending || part < 0 || part >= len(refund.Parts) {
+			return Refund{}, ErrInvalidRefundOp
+		}
+		order.Refunds[i].Parts[part].ProviderRef = providerRef
+		return order.Refunds[i], nil
+	}
+	return Refund{}, ErrRefundNotFound
+}
+
+// SetRefundStatus moves a pending refund to its final state and keeps
+// Amount.Returns equal to the sum of issued refunds. A refund that failed after
+// some of its parts were returned is issued for what was returned.
+func SetRefundStatus(order *Order, refundID, status, providerRef string) (Refund, error) {
+	for i, refund := range order.Refunds {
+		if refund.ID != refundID {
+			continue
+		}
+		if refund.Status != RefundPending || (status != RefundIssued && status != RefundFailed) {
+			return Refund{}, ErrInvalidRefundOp
+		}
+
+		if status == RefundFailed && len(refund.Parts) > 0 && refund.Parts[0].ProviderRef != "" {
+			returned, _ := parseCents(refund.Amount)
+			for _, part := range refund.Parts {
+				if part.ProviderRef == "" {
+					amount, _ := parseCents(part.Amount)
+					returned -= amount
+				}
+			}
+			status, providerRef = RefundIssued, refund.Parts[0].ProviderRef
+			order.Refunds[i].Amount = FormatCents(returned)
+		}
+
+		order.Refunds[i].Status = status
+		order.Refunds[i].ProviderRef = providerRef
+		order.Amount.Returns = FormatCents(refundedCents(*order, RefundIssued))
+		order.Record(RefundUpdated{OrderID: order.ID, Refund: order.Refunds[i]})
+		return order.Refunds[i], nil
+	}
+	return Refund{}, ErrRefundNotFound
+}
+
+// RefundableCents returns how much of the paid amount is not yet issued or pending as a refund.
+func RefundableCents(order Order) int64 {
+	refundable := paidCents(order) - refundedCents(order, RefundIssued) - refundedCents(order, RefundPending)
+	if refundable > 0 {
+		return refundable
+	}
+	return 0
+}
+
+func refundedCents(order Order, status string) int64 {
+	var refunded int64
+	for _, refund := range order.Refunds {
+		if refund.Status == status {
+			cents, _ := parseCents(refund.Amount)
+			refunded += cents
+		}
+	}
+	return refunded
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCatalogProductNotFound = errors.New("product not found")
+	ErrNoReplacement          = errors.New("order product has no replacement")
+	ErrProductReturned        = errors.New("order product has returned items")
+	ErrRefundIssued           = errors.New("replacement refund already issued")
+)
+
+// Replacement is one step in the replacement chain of an order line.
+// Discount and Returns hold the amounts this step added to the order.
+type Replacement struct {
+	ID        string    `json:"id"`
+	ProductID int       `json:"product_id"`
+	Name      string    `json:"name"`
+	Price     string    `json:"price"`
+	Quantity  int       `json:"quantity"`
+	Discount  string    `json:"discount"`
+	Returns   string    `json:"returns"`
+	RefundID  string    `json:"refund_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReplaceProduct replaces what an order line currently holds (the original
+// product or its latest replacement) with quantity items of a catalog product.
+//
+// The amounts are adjusted by the difference between the replaced item and the
+// replacement: a more expensive replacement is given as a discount, a cheaper one
+// lowers the total and, on a paid order, creates a pending refund which is returned.
+func ReplaceProduct(order *Order, lineID string, productID, quantity int) (*Refund, error) {
+	if quantity < 1 {
+		return nil, ErrInvalidQuantity
+	}
+
+	i := findLine(*order, lineID)
+	if i < 0 {
+		return nil, ErrProductNotFound
+	}
+	line := order.Products[i]
+	if line.ReturnedQuantity > 0 {
+		return nil, ErrProductReturned
+	}
+
+	product, ok := FindProduct(productID)
+	if !ok {
+		return nil, ErrCatalogProductNotFound
+	}
+
+	current := line
+	if line.ReplacedWith != nil {
+		current = *line.ReplacedWith
+	}
+	oldValue, _ := parseCents(current.Price)
+	oldValue *= int64(current.Quantity)
+	newValue, _ := parseCents(product.Price)
+	newValue *= int64(quantity)
+
+	step := Replacement{
+		ID:        uuid.New().String(),
+		ProductID: product.ID,
+		Name:      product.Name,
+		Price:     product.Price,
+		Quantity:  quantity,
+		Discount:  FormatCents(max(newValue-oldValue, 0)),
+		Returns:   FormatCents(max(oldValue-newValue, 0)),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var refund *Refund
+	if oldValue > newValue && order.Status == StatusPaid {
+		r, err := AddRefund(order, step.Returns, RefundSourceReplacement, "Replacement of "+current.Name)
+		if err != nil {
+			return nil, err
+		}
+		step.RefundID = r.ID
+		refund = &r
+	}
+
+	addCents(&order.Amount.Discount, max(newValue-oldValue, 0))
+	addCents(&order.Amount.Total, -max(oldValue-newValue, 0))
+
+	line.Replacements = append(line.Replacements, step)
+	line.ReplacedWith = step.orderProduct()
+	order.Products[i] = line
+	order.Record(ProductReplaced{OrderID: order.ID, LineID: lineID, Replacement: step})
+
+	return refund, nil
+}
+
+// UndoReplacement removes the last replacement of an order line and reverts
+// the amounts it changed. A replacement whose refund was issued (or may still be)
+// cannot be undone.
+func UndoReplacement(order *Order, lineID string) error {
+	i := findLine(*order, lineID)
+	if i < 0 {
+		return ErrProductNotFound
+	}
+	line := order.Products[i]
+	if len(line.Replacements) == 0 {
+		return ErrNoReplacement
+	}
+	if line.ReturnedQuantity > 0 {
+		return ErrProductReturned
+	}
+
+	step := line.Replacements[len(line.Replacements)-1]
+	if step.RefundID != "" {
+		for _, refund := range order.Refunds {
+			if refund.ID == step.RefundID && refund.Status != RefundFailed {
+				return ErrRefundIssued
+			}
+		}
+	}
+
+	discount, _ := parseCents(step.Discount)
+	returns, _ := parseCents(step.Returns)
+	addCents(&order.Amount.Discount, -discount)
+	addCents(&order.Amount.Total, returns)
+
+	line.Replacements = line.Replacements[:len(line.Replacements)-1]
+	line.ReplacedWith = nil
+	if n := len(line.Replacements); n > 0 {
+		line.ReplacedWith = line.Replacements[n-1].orderProduct()
+	}
+	order.Products[i] = line
+	order.Record(ReplacementUndone{OrderID: order.ID, LineID: lineID, Replacement: step})
+
+	return nil
+}
+
+// LineCents returns what an order line adds to the order total, in cents: the value
+// of what it currently holds (its latest replacement, or the original product),
+// less the discounts its replacements gave. Like ReplaceProduct, a more expensive
+// replacement does not raise the total while a cheaper one lowers it.
+func LineCents(line OrderProduct) int64 {
+	item := line
+	if line.ReplacedWith != nil {
+		item = *line.ReplacedWith
+	}
+	value, _ := parseCents(item.Price)
+	value *= int64(item.Quantity)
+	for _, step := range line.Replacements {
+		discount, _ := parseCents(step.Discount)
+		value -= discount
+	}
+	return max(value, 0)
+}
+
+func (r Replacement) orderProduct() *OrderProduct {
+	return &OrderProduct{
+		ID:        r.ID,
+		ProductID: r.ProductID,
+		Name:      r.Name,
+		Price:     r.Price,
+		Quantity:  r.Quantity,
+	}
+}
+
+func findLine(order Order, lineID string) int {
+	for i, product := range order.Products {
+		if product.ID == lineID {
+			return i
+		}
+	}
+	return -1
+}
+
+// addCents adds a (possibly negative) number of cents to a money string, never going below zero.
+func addCents(amount *string, cents int64) {
+	current, _ := parseCents(*amount)
+	*amount = FormatCents(max(current+cents, 0))
+}
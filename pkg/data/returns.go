@@ -0,0 +1,60 @@
+package data
+
+import "errors"
+
+var (
+	ErrProductNotFound = errors.New("order product not found")
+	ErrInvalidQuantity = errors.New("invalid quantity")
+	// ErrNothingToRefund is returned for returns of orders whose payments were refunded in full.
+	ErrNothingToRefund = errors.New("nothing left to refund")
+)
+
+type ReturnProductRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// ReturnProduct returns a quantity of a line of a paid order. If the line was
+// replaced, the replacement is what the customer has and can return.
+// The order total is reduced and a pending refund for the returned value,
+// capped at what is left to refund, is created.
+func ReturnProduct(order *Order, lineID string, quantity int) (Refund, error) {
+	if order.Status != StatusPaid {
+		return Refund{}, ErrOrderNotPaid
+	}
+
+	for i, product := range order.Products {
+		if product.ID != lineID {
+			continue
+		}
+
+		item := product
+		if product.ReplacedWith != nil {
+			item = *product.ReplacedWith
+		}
+		if quantity < 1 || quantity > item.Quantity-product.ReturnedQuantity {
+			return Refund{}, ErrInvalidQuantity
+		}
+
+		price, err := parseCents(item.Price)
+		if err != nil {
+			return Refund{}, err
+		}
+		// A discounted replacement can be worth more than was paid for it.
+		value := min(price*int64(quantity), RefundableCents(*order))
+		if value == 0 {
+			return Refund{}, ErrNothingToRefund
+		}
+
+		refund, err := AddRefund(order, FormatCents(value), RefundSourceReturn, "Return of "+item.Name)
+		if err != nil {
+			return Refund{}, err
+		}
+
+		total, _ := parseCents(order.Amount.Total)
+		order.Amount.Total = FormatCents(max(total-value, 0))
+		order.Products[i].ReturnedQuantity += quantity
+		order.Record(ProductReturned{OrderID: order.ID, LineID: lineID, Quantity: quantity})
+		return refund, nil
+	}
+	return Refund{}, ErrProductNotFound
+}
@@ -0,0 +1,189 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is a domain event published on a Bus.
+type Event interface {
+	// Name identifies the event type, e.g. "order.created".
+	Name() string
+	// AggregateID is the ID of the entity the event belongs to.
+	AggregateID() string
+}
+
+// Envelope is a published event with its bus-wide sequence number and publish time.
+type Envelope struct {
+	Seq   uint64
+	Time  time.Time
+	Event Event
+}
+
+// Handler receives published events.
+type Handler func(Envelope)
+
+type subscription struct {
+	handler Handler
+	// ch is nil for synchronous subscribers.
+	ch   chan Envelope
+	done chan struct{}
+	// mu keeps ch from being closed while an event is sent to it.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// deliver hands the event to the subscriber. It reports false if the event was
+// dropped because the queue of an asynchronous subscriber was full.
+func (s *subscription) deliver(env Envelope) bool {
+	if s.ch == nil {
+		s.handler(env)
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return true
+	}
+	select {
+	case s.ch <- env:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops an asynchronous subscriber after it handled its queued events.
+func (s *subscription) close() {
+	if s.ch == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	close(s.ch)
+	s.mu.Unlock()
+	<-s.done
+}
+
+// Bus is an in-process publish/subscribe bus. Synchronous subscribers run in
+// the publishing goroutine, asynchronous ones in their own goroutine. Publishing
+// is serialized, so every subscriber sees events in sequence order; handlers
+// must therefore not publish themselves. Publishing never waits for asynchronous
+// subscribers: events for a full queue are dropped and counted in Dropped.
+type Bus struct {
+	// publish serializes Publish; mu guards the fields below it.
+	publish sync.Mutex
+	mu      sync.Mutex
+	seq     uint64
+	nextID  int
+	subs    map[int]*subscription
+	closed  bool
+	dropped atomic.Uint64
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int]*subscription)}
+}
+
+// Subscribe registers a synchronous handler and returns a function removing it.
+func (b *Bus) Subscribe(h Handler) (unsubscribe func()) {
+	return b.add(&subscription{handler: h})
+}
+
+// SubscribeAsync registers a handler running in its own goroutine with a queue of
+// buffer events. Events published while the queue is full are dropped. The
+// returned function removes the handler after it processed the queued events.
+func (b *Bus) SubscribeAsync(h Handler, buffer int) (unsubscribe func()) {
+	sub := &subscription{handler: h, ch: make(chan Envelope, buffer), done: make(chan struct{})}
+	go func() {
+		defer close(sub.done)
+		for env := range sub.ch {
+			h(env)
+		}
+	}()
+	return b.add(sub)
+}
+
+func (b *Bus) add(sub *subscription) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		if sub.ch != nil {
+			close(sub.ch)
+		}
+		return func() {}
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.remove(id) })
+	}
+}
+
+func (b *Bus) remove(id int) {
+	b.mu.Lock()
+	sub, ok := b.subs[id]
+	delete(b.subs, id)
+	b.mu.Unlock()
+
+	if ok {
+		sub.close()
+	}
+}
+
+// Publish delivers the events to all subscribers, in order. The bus is not
+// locked while the events are delivered, so subscribers may (un)subscribe.
+func (b *Bus) Publish(evs ...Event) {
+	b.publish.Lock()
+	defer b.publish.Unlock()
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	envs := make([]Envelope, len(evs))
+	for i, ev := range evs {
+		b.seq++
+		envs[i] = Envelope{Seq: b.seq, Time: time.Now().UTC(), Event: ev}
+	}
+	subs := make([]*subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, env := range envs {
+		for _, sub := range subs {
+			if !sub.deliver(env) {
+				b.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because the queue of an
+// asynchronous subscriber was full.
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Close removes all subscribers, waiting for asynchronous ones to drain their
+// queues. Events published afterwards are dropped.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	b.closed = true
+	ids := make([]int, 0, len(b.subs))
+	for id := range b.subs {
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+
+	for _, id := range ids {
+		b.remove(id)
+	}
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testEvent struct {
+	name string
+	id   string
+}
+
+func (e testEvent) Name() string        { return e.name }
+func (e testEvent) AggregateID() string { return e.id }
+
+func TestSyncSubscriber(t *testing.T) {
+	bus := NewBus()
+	rec := NewRecorder(bus)
+
+	bus.Publish(testEvent{"a", "1"}, testEvent{"b", "2"})
+	rec.Close()
+	bus.Publish(testEvent{"c", "1"})
+
+	if got := rec.Names(""); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("recorded events: got %v", got)
+	}
+	if got := rec.Names("1"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("recorded events of aggregate 1: got %v", got)
+	}
+}
+
+func TestAsyncSubscriberOrder(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	var seqs []uint64
+	unsubscribe := bus.SubscribeAsync(func(env Envelope) {
+		mu.Lock()
+		defer mu.Unlock()
+		seqs = append(seqs, env.Seq)
+	}, 10)
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(testEvent{"a", "1"})
+	}
+	// Unsubscribing waits for the queued events to be handled.
+	unsubscribe()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seqs) != 10 {
+		t.Fatalf("handled %d events, want 10", len(seqs))
+	}
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Errorf("event %d has sequence %d", i, seq)
+		}
+	}
+}
+
+func TestCloseDrainsAsyncSubscribers(t *testing.T) {
+	bus := NewBus()
+
+	handled := 0
+	bus.SubscribeAsync(func(Envelope) { handled++ }, 5)
+	bus.Publish(testEvent{"a", "1"}, testEvent{"b", "1"})
+	bus.Close()
+	bus.Publish(testEvent{"c", "1"})
+
+	if handled != 2 {
+		t.Errorf("handled %d events, want 2", handled)
+	}
+}
+
+func TestFullAsyncSubscriberDropsEvents(t *testing.T) {
+	bus := NewBus()
+
+	release := make(chan struct{})
+	var handled atomic.Int32
+	unsubscribe := bus.SubscribeAsync(func(Envelope) {
+		<-release
+		handled.Add(1)
+	}, 1)
+	var synced int
+	bus.Subscribe(func(Envelope) { synced++ })
+
+	// The first event blocks the handler and the second fills the queue; publishing
+	// the others must neither block nor starve the synchronous subscriber.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			bus.Publish(testEvent{"a", "1"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full subscriber queue")
+	}
+	close(release)
+	unsubscribe()
+
+	if synced != 5 {
+		t.Errorf("synchronous subscriber handled %d events, want 5", synced)
+	}
+	if got := int(handled.Load()) + int(bus.Dropped()); got != 5 || bus.Dropped() < 3 {
+		t.Errorf("handled %d and dropped %d events, want 5 in total and at least 3 dropped", handled.Load(), bus.Dropped())
+	}
+}
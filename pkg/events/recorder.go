@@ -0,0 +1,49 @@
+package events
+
+import "sync"
+
+// Recorder captures the events published on a Bus, for assertions in tests.
+type Recorder struct {
+	mu          sync.Mutex
+	envelopes   []Envelope
+	unsubscribe func()
+}
+
+// NewRecorder starts recording the events of the bus until Close is called.
+func NewRecorder(bus *Bus) *Recorder {
+	r := &Recorder{}
+	r.unsubscribe = bus.Subscribe(func(env Envelope) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.envelopes = append(r.envelopes, env)
+	})
+	return r
+}
+
+// Close stops recording.
+func (r *Recorder) Close() {
+	r.unsubscribe()
+}
+
+// Events returns the recorded events of the given aggregate, or all events if id is empty.
+func (r *Recorder) Events(id string) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var evs []Event
+	for _, env := range r.envelopes {
+		if id == "" || env.Event.AggregateID() == id {
+			evs = append(evs, env.Event)
+		}
+	}
+	return evs
+}
+
+// Names returns the names of the recorded events of the given aggregate, or of all events if id is empty.
+func (r *Recorder) Names(id string) []string {
+	evs := r.Events(id)
+	names := make([]string, len(evs))
+	for i, ev := range evs {
+		names[i] = ev.Name()
+	}
+	return names
+}
@@ -0,0 +1,134 @@
+// Package janitor expires abandoned orders, purges them after a retention period
+// and has refunds left pending retried.
+package janitor
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/util"
+)
+
+// Config of a Janitor. A zero TTL or Retention disables that step.
+type Config struct {
+	// TTL is how long a NEW order may stay unchanged before it expires.
+	TTL time.Duration
+	// Retention is how long an expired order is kept before it is purged.
+	Retention time.Duration
+	// Interval is the time between sweeps, a minute by default.
+	Interval time.Duration
+	// Report, if set, receives the counts of every sweep.
+	Report func(expired, purged int)
+	// RetryRefunds, if set, is called after every sweep to retry the refunds left
+	// pending by payment provider timeouts. It returns how many it resolved.
+	RetryRefunds func() int
+}
+
+// Janitor periodically sweeps the order store.
+type Janitor struct {
+	cfg Config
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// New returns a janitor with the config. It does nothing until started.
+func New(cfg Config) *Janitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	return &Janitor{cfg: cfg, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start sweeps the store every Interval until Stop is called.
+func (j *Janitor) Start() {
+	j.startOnce.Do(func() {
+		go j.run()
+	})
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case now := <-ticker.C:
+			expired, purged := j.Sweep(now)
+			if expired > 0 || purged > 0 {
+				slog.Info("janitor swept orders", "expired", expired, "purged", purged)
+			}
+			if j.cfg.Report != nil {
+				j.cfg.Report(expired, purged)
+			}
+			if j.cfg.RetryRefunds != nil {
+				if resolved := j.cfg.RetryRefunds(); resolved > 0 {
+					slog.Info("janitor retried refunds", "resolved", resolved)
+				}
+			}
+		}
+	}
+}
+
+// Stop stops the janitor and waits for a running sweep to finish.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+	j.startOnce.Do(func() {
+		close(j.done)
+	})
+	<-j.done
+}
+
+// Sweep expires the NEW orders unchanged for longer than the TTL and purges the
+// orders expired for longer than the retention, as of now. Orders with payments
+// are neither expired nor purged, so the money they captured is never lost with them.
+func (j *Janitor) Sweep(now time.Time) (expired, purged int) {
+	var ids []string
+	data.Orders.Range(func(key, _ any) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+
+	for _, id := range ids {
+		order, ok := util.LoadOrder(id)
+		lastModified, known := data.LastModified(id)
+		if !ok || !known {
+			continue
+		}
+		age := now.Sub(lastModified)
+
+		switch {
+		case len(order.Payments) > 0:
+		case order.Status == data.StatusNew && j.cfg.TTL > 0 && age > j.cfg.TTL:
+			if expireOrder(order) {
+				expired++
+			}
+		case order.Status == data.StatusExpired && j.cfg.Retention > 0 && age > j.cfg.Retention:
+			data.DeleteOrder(id)
+			purged++
+		}
+	}
+	return expired, purged
+}
+
+// expireOrder expires the loaded order unless it changed since, which it
+// reports. A changed order is no longer abandoned; the next sweep checks it again.
+func expireOrder(order data.Order) bool {
+	// Stock is not reserved and orders with payments are not expired, so expiring
+	// only changes the status.
+	data.SetStatus(&order, data.StatusExpired)
+	if err := data.SaveOrderIfUnchanged(order); err != nil {
+		slog.Info("order changed while expiring it", "order_id", order.ID)
+		return false
+	}
+	slog.Info("order status changed", "order_id", order.ID, "from", data.StatusNew, "to", data.StatusExpired)
+	return true
+}
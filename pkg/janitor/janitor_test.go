@@ -0,0 +1,105 @@
+package janitor
+
+import (
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/data"
+	"awesomeProject/pkg/events"
+	"awesomeProject/pkg/util"
+)
+
+func TestSweep(t *testing.T) {
+	recorder := events.NewRecorder(data.Events)
+	defer recorder.Close()
+
+	abandoned := data.NewOrder("abandoned")
+	data.SaveOrder(abandoned)
+	paid := data.NewOrder("paid")
+	data.SetStatus(&paid, data.StatusPaid)
+	data.SaveOrder(paid)
+
+	j := New(Config{TTL: time.Hour, Retention: 24 * time.Hour})
+	now := time.Now()
+
+	if expired, purged := j.Sweep(now); expired != 0 || purged != 0 {
+		t.Errorf("fresh orders swept: expired %d, purged %d", expired, purged)
+	}
+
+	if expired, purged := j.Sweep(now.Add(2 * time.Hour)); expired != 1 || purged != 0 {
+		t.Errorf("after the TTL: expired %d, purged %d, want 1, 0", expired, purged)
+	}
+	if order, _ := util.LoadOrder("abandoned"); order.Status != data.StatusExpired {
+		t.Errorf("abandoned order status: got %s, want EXPIRED", order.Status)
+	}
+	if order, _ := util.LoadOrder("paid"); order.Status != data.StatusPaid {
+		t.Errorf("paid order status: got %s, want PAID", order.Status)
+	}
+	if names := recorder.Names("abandoned"); names[len(names)-1] != data.EventOrderExpired {
+		t.Errorf("events of the abandoned order: %v", names)
+	}
+
+	// The retention counts from the expiry.
+	if expired, purged := j.Sweep(time.Now().Add(25 * time.Hour)); expired != 0 || purged != 1 {
+		t.Errorf("after the retention: expired %d, purged %d, want 0, 1", expired, purged)
+	}
+	if _, ok := util.LoadOrder("abandoned"); ok {
+		t.Error("expired order not purged")
+	}
+	if _, ok := data.OrderHistory("abandoned"); ok {
+		t.Error("history of the purged order kept")
+	}
+}
+
+// Test that an order changed after the sweep loaded it is not expired.
+func TestExpireChangedOrder(t *testing.T) {
+	data.SaveOrder(data.NewOrder("changed"))
+	stale, _ := util.LoadOrder("changed")
+
+	current, _ := util.LoadOrder("changed")
+	data.SetStatus(&current, data.StatusPaid)
+	data.SaveOrder(current)
+
+	if expireOrder(stale) {
+		t.Error("changed order expired")
+	}
+	if order, _ := util.LoadOrder("changed"); order.Status != data.StatusPaid {
+		t.Errorf("changed order status: got %s, want PAID", order.Status)
+	}
+}
+
+// Test that orders with payments are neither expired nor purged.
+func TestSweepKeepsPaidMoney(t *testing.T) {
+	partial := data.NewOrder("partial")
+	partial.Amount.Total = "2.33"
+	if _, err := data.AddPayment(&partial, data.Payment{Amount: "1.00", Method: data.PaymentMethodCash}); err != nil {
+		t.Fatal(err)
+	}
+	data.SaveOrder(partial)
+
+	expiredWithPayment := data.NewOrder("expired-with-payment")
+	expiredWithPayment.Payments = []data.Payment{{Amount: "1.00", Method: data.PaymentMethodCash}}
+	data.SetStatus(&expiredWithPayment, data.StatusExpired)
+	data.SaveOrder(expiredWithPayment)
+
+	j := New(Config{TTL: time.Hour, Retention: time.Hour})
+	j.Sweep(time.Now().Add(2 * time.Hour))
+
+	if order, _ := util.LoadOrder("partial"); order.Status != data.StatusNew {
+		t.Errorf("partially paid order status: got %s, want NEW", order.Status)
+	}
+	if _, ok := util.LoadOrder("expired-with-payment"); !ok {
+		t.Error("expired order with a payment purged")
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	j := New(Config{TTL: time.Hour, Interval: time.Millisecond})
+	j.Start()
+	time.Sleep(5 * time.Millisecond)
+	j.Stop()
+	j.Stop()
+
+	// A janitor that never started stops immediately.
+	New(Config{}).Stop()
+}
@@ -0,0 +1,198 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Outcome is the scripted result of a single Fake provider call.
+type Outcome int
+
+const (
+	Succeed Outcome = iota
+	Decline
+	// Timeout blocks the call until its context is done.
+	Timeout
+)
+
+// Fake is an in-process Provider for local development and tests.
+// Every call succeeds unless outcomes were queued with Script.
+type Fake struct {
+	mu           sync.Mutex
+	script       []Outcome
+	transactions map[string]Transaction
+	// refunds maps idempotency keys to their refund transactions.
+	refunds map[string]Transaction
+	// refunded maps capture IDs to the cents refunded from them.
+	refunded map[string]int64
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		transactions: make(map[string]Transaction),
+		refunds:      make(map[string]Transaction),
+		refunded:     make(map[string]int64),
+	}
+}
+
+// Script queues outcomes for the next provider calls, in order.
+func (f *Fake) Script(outcomes ...Outcome) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.script = append(f.script, outcomes...)
+}
+
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error) {
+	return f.transact(ctx, "", req.Amount, StatusAuthorized)
+}
+
+func (f *Fake) Capture(ctx context.Context, authorizationID, amount string) (Transaction, error) {
+	if err := f.expect(authorizationID, StatusAuthorized); err != nil {
+		return Transaction{}, err
+	}
+	return f.transact(ctx, authorizationID, amount, StatusCaptured)
+}
+
+func (f *Fake) Void(_ context.Context, authorizationID string) (Transaction, error) {
+	if err := f.expect(authorizationID, StatusAuthorized); err != nil {
+		return Transaction{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx := f.transactions[authorizationID]
+	tx.Status = StatusVoided
+	f.transactions[authorizationID] = tx
+	return tx, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, captureID, amount, idempotencyKey string) (Transaction, error) {
+	f.mu.Lock()
+	tx, ok := f.refunds[idempotencyKey]
+	f.mu.Unlock()
+	if ok {
+		return tx, nil
+	}
+
+	if err := f.expect(captureID, StatusCaptured); err != nil {
+		return Transaction{}, err
+	}
+	cents, err := f.reserveRefund(captureID, amount)
+	if err != nil {
+		return Transaction{}, err
+	}
+	tx, err = f.transact(ctx, captureID, amount, StatusRefunded)
+	f.mu.Lock()
+	if err == nil {
+		f.refunds[idempotencyKey] = tx
+	} else {
+		f.refunded[captureID] -= cents
+	}
+	f.mu.Unlock()
+	return tx, err
+}
+
+// reserveRefund adds the amount to what was refunded from the capture, unless
+// that would exceed the captured amount.
+func (f *Fake) reserveRefund(captureID, amount string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	captured, ok := cents(f.transactions[captureID].Amount)
+	refund, valid := cents(amount)
+	if !ok || !valid || refund <= 0 {
+		return 0, fmt.Errorf("invalid refund amount %q", amount)
+	}
+	if f.refunded[captureID]+refund > captured {
+		return 0, fmt.Errorf("refund of %s exceeds what is left of capture %s", amount, captureID)
+	}
+	f.refunded[captureID] += refund
+	return refund, nil
+}
+
+// cents parses a decimal money string such as "12.34".
+func cents(amount string) (int64, bool) {
+	euros, fraction, ok := strings.Cut(amount, ".")
+	if !ok || len(fraction) != 2 {
+		return 0, false
+	}
+	e, err1 := strconv.ParseUint(euros, 10, 64)
+	c, err2 := strconv.ParseUint(fraction, 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return int64(e*100 + c), true
+}
+
+func (f *Fake) Status(_ context.Context, transactionID string) (Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx, ok := f.transactions[transactionID]
+	if !ok {
+		return Transaction{}, ErrNotFound
+	}
+	return tx, nil
+}
+
+// Count returns how many recorded transactions have the status.
+func (f *Fake) Count(status string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, tx := range f.transactions {
+		if tx.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *Fake) expect(parentID, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parent, ok := f.transactions[parentID]
+	if !ok {
+		return ErrNotFound
+	}
+	if parent.Status != status {
+		return fmt.Errorf("transaction %s is %s, want %s", parentID, parent.Status, status)
+	}
+	return nil
+}
+
+func (f *Fake) transact(ctx context.Context, parentID, amount, status string) (Transaction, error) {
+	tx := Transaction{ID: uuid.New().String(), ParentID: parentID, Amount: amount, Status: status}
+
+	switch f.next() {
+	case Decline:
+		tx.Status = StatusDeclined
+		f.record(tx)
+		return tx, ErrDeclined
+	case Timeout:
+		<-ctx.Done()
+		return Transaction{}, fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	}
+
+	f.record(tx)
+	return tx, nil
+}
+
+func (f *Fake) next() Outcome {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.script) == 0 {
+		return Succeed
+	}
+	outcome := f.script[0]
+	f.script = f.script[1:]
+	return outcome
+}
+
+func (f *Fake) record(tx Transaction) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.transactions[tx.ID] = tx
+}
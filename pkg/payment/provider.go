@@ -0,0 +1,52 @@
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrDeclined = errors.New("payment declined")
+	ErrTimeout  = errors.New("payment provider timed out")
+	ErrNotFound = errors.New("transaction not found")
+)
+
+// Transaction statuses reported by a Provider.
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided"
+	StatusDeclined   = "declined"
+)
+
+// Provider is a payment service provider used by the order flow.
+// Amounts are decimal money strings, the same as in data.Amount.
+type Provider interface {
+	// Authorize reserves the amount without moving any money.
+	Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error)
+	// Capture collects a previously authorized amount.
+	Capture(ctx context.Context, authorizationID, amount string) (Transaction, error)
+	// Void releases an authorization that will not be captured.
+	Void(ctx context.Context, authorizationID string) (Transaction, error)
+	// Refund returns (part of) a captured amount. Calls with the idempotency key of
+	// an earlier refund return that refund instead of returning the money again, so
+	// refunds whose outcome is unknown can be retried.
+	Refund(ctx context.Context, captureID, amount, idempotencyKey string) (Transaction, error)
+	// Status looks up a transaction created by any of the calls above.
+	Status(ctx context.Context, transactionID string) (Transaction, error)
+}
+
+type AuthorizeRequest struct {
+	OrderID   string
+	Amount    string
+	Method    string
+	Reference string
+}
+
+type Transaction struct {
+	ID       string `json:"id"`
+	ParentID string `json:"parent_id,omitempty"`
+	Amount   string `json:"amount"`
+	Status   string `json:"status"`
+}
@@ -0,0 +1,159 @@
+// Package ratelimit limits the request rate of clients with token buckets and
+// counts daily quotas.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle clients are forgotten.
+const sweepInterval = time.Minute
+
+var ErrInvalidRule = errors.New("invalid rate limit")
+
+// Rule allows Rate requests per second on average and bursts of up to Burst requests.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseRule parses "<rate>[:<burst>]", e.g. "5:10". The burst defaults to the rate, rounded up.
+func ParseRule(s string) (Rule, error) {
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r <= 0 || math.IsInf(r, 0) {
+		return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+	}
+	rule := Rule{Rate: r, Burst: int(math.Ceil(r))}
+	if hasBurst {
+		if rule.Burst, err = strconv.Atoi(burst); err != nil || rule.Burst < 1 {
+			return Rule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+		}
+	}
+	return rule, nil
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, if not allowed.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key.
+type Limiter struct {
+	rule Rule
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter returns a limiter applying the rule to every key.
+func NewLimiter(rule Rule) *Limiter {
+	return &Limiter{rule: rule, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from the bucket of the key.
+func (l *Limiter) Allow(key string, now time.Time) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	d := Decision{Limit: l.rule.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.duration(1 - b.tokens)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = l.duration(float64(l.rule.Burst) - b.tokens)
+	return d
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.rule.Burst), b.tokens+elapsed*l.rule.Rate)
+		b.last = now
+	}
+}
+
+// duration returns the time it takes to refill the given number of tokens.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rule.Rate * float64(time.Second))
+}
+
+// sweep forgets the buckets that are full again, they are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now); b.tokens >= float64(l.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Quota allows a number of uses per key and UTC day.
+type Quota struct {
+	limit int
+
+	mu     sync.Mutex
+	day    string
+	counts map[string]int
+}
+
+// NewQuota returns a quota of limit uses per key and day.
+func NewQuota(limit int) *Quota {
+	return &Quota{limit: limit, counts: make(map[string]int)}
+}
+
+// Use counts a use of the key unless its quota is exhausted. It returns the remaining
+// uses of the day and the time until the quota resets.
+func (q *Quota) Use(key string, now time.Time) (allowed bool, remaining int, reset time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now = now.UTC()
+	if day := now.Format(time.DateOnly); day != q.day {
+		q.day, q.counts = day, make(map[string]int)
+	}
+	year, month, day := now.Date()
+	reset = time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC).Sub(now)
+
+	if q.counts[key] >= q.limit {
+		return false, 0, reset
+	}
+	q.counts[key]++
+	return true, q.limit - q.counts[key], reset
+}
+
+// Limit returns the number of uses per day.
+func (q *Quota) Limit() int {
+	return q.limit
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(Rule{Rate: 2, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if d := l.Allow("a", now); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, d)
+		}
+	}
+	d := l.Allow("a", now)
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != 1500*time.Millisecond {
+		t.Errorf("request over the burst: %+v", d)
+	}
+	if d := l.Allow("b", now); !d.Allowed {
+		t.Error("other keys have their own bucket")
+	}
+
+	if d := l.Allow("a", now.Add(500*time.Millisecond)); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("after refilling one token: %+v", d)
+	}
+
+	l.Allow("c", now.Add(time.Hour))
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("idle bucket not swept")
+	}
+}
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+	q := NewQuota(2)
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+
+	if ok, remaining, reset := q.Use("a", now); !ok || remaining != 1 || reset != time.Hour {
+		t.Errorf("first use: %v %d %v", ok, remaining, reset)
+	}
+	q.Use("a", now)
+	if ok, _, _ := q.Use("a", now); ok {
+		t.Error("quota exceeded but allowed")
+	}
+	if ok, _, _ := q.Use("a", now.Add(2*time.Hour)); !ok {
+		t.Error("quota not reset the next day")
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	t.Parallel()
+	for s, want := range map[string]Rule{"5": {5, 5}, "0.5": {0.5, 1}, "5:20": {5, 20}} {
+		if got, err := ParseRule(s); err != nil || got != want {
+			t.Errorf("%q: got %+v, %v, want %+v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "0", "-1", "5:0", "x:1"} {
+		if _, err := ParseRule(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
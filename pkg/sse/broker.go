@@ -0,0 +1,124 @@
+package sse
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Message is a single server-sent event.
+type Message struct {
+	ID    uint64
+	Event string
+	// Topic is used to filter messages per subscriber, it is not sent.
+	Topic string
+	Data  []byte
+}
+
+// WriteTo writes the message in text/event-stream format.
+func (m Message) WriteTo(w *bufio.Writer) error {
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\n", m.ID, m.Event); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(m.Data), "\n") {
+		if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+			return err
+		}
+	}
+	if _, err := w.WriteString("\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type subscriber struct {
+	ch     chan Message
+	filter func(Message) bool
+}
+
+// Broker fans messages out to subscribers and keeps the latest ones so that
+// a reconnecting client can resume after the last message it received.
+type Broker struct {
+	mu      sync.Mutex
+	history []Message
+	size    int
+	nextID  int
+	subs    map[int]*subscriber
+	closed  bool
+}
+
+// NewBroker returns a broker replaying up to size messages.
+func NewBroker(size int) *Broker {
+	return &Broker{size: size, subs: make(map[int]*subscriber)}
+}
+
+// Publish sends the message to all matching subscribers. A subscriber that
+// cannot keep up is disconnected; it can resume from its last message.
+func (b *Broker) Publish(msg Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.history = append(b.history, msg)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for id, sub := range b.subs {
+		if sub.filter != nil && !sub.filter(msg) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			close(sub.ch)
+			delete(b.subs, id)
+		}
+	}
+}
+
+// Subscribe returns the buffered messages after lastID that match the filter
+// and a channel receiving the following ones. The channel is closed when the
+// subscriber is too slow, cancel is called or the broker is closed.
+func (b *Broker) Subscribe(lastID uint64, filter func(Message) bool) (replay []Message, ch <-chan Message, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range b.history {
+		if msg.ID > lastID && (filter == nil || filter(msg)) {
+			replay = append(replay, msg)
+		}
+	}
+
+	sub := &subscriber{ch: make(chan Message, 64), filter: filter}
+	if b.closed {
+		close(sub.ch)
+		return replay, sub.ch, func() {}
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+
+	return replay, sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[id]; ok {
+			close(sub.ch)
+			delete(b.subs, id)
+		}
+	}
+}
+
+// Close disconnects all subscribers.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for id, sub := range b.subs {
+		close(sub.ch)
+		delete(b.subs, id)
+	}
+}
@@ -0,0 +1,165 @@
+// Package tracing sets up OpenTelemetry tracing with W3C Trace Context propagation.
+// Spans are exported in the OTLP JSON file format, one ExportTraceServiceRequest
+// per line, to stdout or a file that collectors can read without a network exporter.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// scope is the instrumentation scope of the spans.
+const scope = "awesomeProject/pkg/tracing"
+
+var propagator = propagation.TraceContext{}
+
+// NewProvider returns a tracer provider of the service that exports ended spans in
+// batches. Shutting the provider down flushes the spans not exported yet. A nil
+// exporter drops all spans; trace context is still propagated.
+func NewProvider(service string, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(options...)
+}
+
+// Tracer returns the tracer of the provider.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	return provider.Tracer(scope)
+}
+
+// NewWriterExporter returns an exporter writing every batch of spans as an OTLP JSON line.
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return otlptrace.New(context.Background(), &jsonLinesClient{w: w})
+}
+
+// NewFileExporter returns an exporter appending OTLP JSON lines to the file at path,
+// which it closes on shutdown.
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := NewWriterExporter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileExporter{SpanExporter: exporter, file: file}, nil
+}
+
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.file.Close())
+}
+
+// jsonLinesClient is an otlptrace.Client writing OTLP JSON lines instead of sending
+// the spans to a collector.
+type jsonLinesClient struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (c *jsonLinesClient) Start(context.Context) error { return nil }
+
+func (c *jsonLinesClient) Stop(context.Context) error { return nil }
+
+func (c *jsonLinesClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	line, err := marshalOTLPJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.w.Write(append(line, '\n'))
+	return err
+}
+
+// marshalOTLPJSON encodes a request as OTLP JSON: the protobuf JSON mapping with enums
+// as numbers and trace and span IDs as hex strings instead of base64.
+func marshalOTLPJSON(request *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	raw, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if err := hexIDs(doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// hexIDs re-encodes the base64 trace and span IDs in a decoded OTLP JSON document as hex.
+func hexIDs(doc any) error {
+	switch v := doc.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if id, ok := value.(string); ok && (key == "traceId" || key == "spanId" || key == "parentSpanId") {
+				b, err := base64.StdEncoding.DecodeString(id)
+				if err != nil {
+					return err
+				}
+				v[key] = hex.EncodeToString(b)
+				continue
+			}
+			if err := hexIDs(value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if err := hexIDs(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ContextWithTraceparent returns a context carrying the remote span context of a W3C
+// traceparent header value. An invalid value leaves ctx unchanged.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
+
+// Traceparent formats the span context as a W3C traceparent header value.
+func Traceparent(sc trace.SpanContext) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier.Get("traceparent")
+}
+
+// Start starts a child span of the span of ctx with the tracer provider of that span.
+// Without a span in ctx it returns a span that is not recorded.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer(trace.SpanFromContext(ctx).TracerProvider()).Start(ctx, name, trace.WithAttributes(attributes...))
+}
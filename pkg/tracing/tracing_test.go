@@ -0,0 +1,168 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceparent(t *testing.T) {
+	t.Parallel()
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc := trace.SpanContextFromContext(ContextWithTraceparent(context.Background(), value))
+	if !sc.IsValid() || !sc.IsRemote() || !sc.IsSampled() || sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("got %+v", sc)
+	}
+	if got := Traceparent(sc); got != value {
+		t.Errorf("Traceparent: got %q, want %q", got, value)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+	} {
+		if trace.SpanContextFromContext(ContextWithTraceparent(context.Background(), invalid)).IsValid() {
+			t.Errorf("%q parsed", invalid)
+		}
+	}
+}
+
+// otlpLine is the part of an OTLP JSON line the tests check.
+type otlpLine struct {
+	ResourceSpans []struct {
+		Resource   struct{ Attributes []otlpAttribute }
+		ScopeSpans []struct {
+			Scope struct{ Name string }
+			Spans []otlpSpan
+		}
+	}
+}
+
+type otlpSpan struct {
+	Name         string
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Kind         int
+	Attributes   []otlpAttribute
+}
+
+type otlpAttribute struct {
+	Key   string
+	Value map[string]any
+}
+
+// exportedSpans decodes the spans of the OTLP JSON lines in order.
+func exportedSpans(t *testing.T, out string) []otlpSpan {
+	t.Helper()
+	var spans []otlpSpan
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var decoded otlpLine
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		for _, rs := range decoded.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestSpans(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	exporter, err := NewWriterExporter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider("test", exporter)
+	tracer := Tracer(provider)
+
+	remote := ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := tracer.Start(remote, "GET /", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := Start(ctx, "child", attribute.Int("n", 1))
+	child.End()
+	server.End()
+	server.End()
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exportedSpans(t, out.String())
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "child" || span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != server.SpanContext().SpanID().String() {
+		t.Errorf("unexpected exported span: %+v", span)
+	}
+	if len(span.Attributes) != 1 || span.Attributes[0].Key != "n" || span.Attributes[0].Value["intValue"] != "1" {
+		t.Errorf("unexpected attributes: %+v", span.Attributes)
+	}
+	if server := spans[1]; server.Kind != int(trace.SpanKindServer) || server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected server span: %+v", server)
+	}
+
+	// Unsampled traces are not exported.
+	out.Reset()
+	unsampled := ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span2 := tracer.Start(unsampled, "GET /")
+	span2.End()
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Error("unsampled span exported")
+	}
+
+	// Without a span in the context nothing is recorded.
+	if _, span := Start(context.Background(), "orphan"); span.IsRecording() {
+		t.Error("span without a parent recorded")
+	}
+}
+
+func TestFileExporterShutdown(t *testing.T) {
+	path := t.TempDir() + "/traces.jsonl"
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider("test", exporter)
+	_, span := Tracer(provider).Start(context.Background(), "GET /")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.(*fileExporter).file.Close(); err == nil {
+		t.Error("file of the exporter not closed")
+	}
+	// Shutting down flushed the batch of the ended span.
+	raw, _ := os.ReadFile(path)
+	var line otlpLine
+	if err := json.Unmarshal(raw, &line); err != nil || len(line.ResourceSpans) != 1 {
+		t.Fatalf("no OTLP JSON line written to the file: %s", raw)
+	}
+	rs := line.ResourceSpans[0]
+	if len(rs.ScopeSpans) != 1 || rs.ScopeSpans[0].Scope.Name != scope || rs.ScopeSpans[0].Spans[0].Name != "GET /" {
+		t.Errorf("span not written to the file: %s", raw)
+	}
+	if len(rs.Resource.Attributes) != 1 || rs.Resource.Attributes[0].Value["stringValue"] != "test" {
+		t.Errorf("service not written to the file: %s", raw)
+	}
+
+	// Providers without an exporter shut down too.
+	if err := NewProvider("test", nil).Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
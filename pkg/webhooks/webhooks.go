@@ -0,0 +1,416 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"awesomeProject/pkg/events"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+const (
+	// maxDeliveryLog is the number of delivery attempts kept per subscription.
+	maxDeliveryLog = 100
+	// maxDeadLetters is the number of dead letters kept, the latest ones.
+	maxDeadLetters = 1000
+)
+
+type Config struct {
+	// MaxAttempts is the number of delivery attempts before an event is dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; it doubles with every attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds a single delivery attempt.
+	Timeout time.Duration
+	// QueueSize is the number of events queued for each subscription, 256 by default.
+	// Events for a subscription whose queue is full are dropped and counted.
+	QueueSize int
+	Client    *http.Client
+}
+
+// Subscription sends the events matching Events (all events if empty) to URL.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is a single attempt to deliver an event to a subscription.
+type Delivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	Event          string    `json:"event"`
+	EventSeq       uint64    `json:"event_seq"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Success        bool      `json:"success"`
+	Time           time.Time `json:"time"`
+}
+
+// DeadLetter is an event that could not be delivered within MaxAttempts.
+type DeadLetter struct {
+	DeliveryID     string          `json:"delivery_id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error"`
+	Time           time.Time       `json:"time"`
+}
+
+// job is an event queued for delivery to a subscription.
+type job struct {
+	sub  Subscription
+	id   string
+	env  events.Envelope
+	body []byte
+}
+
+// payload is the body POSTed to subscribers.
+type payload struct {
+	ID        string       `json:"id"`
+	Event     string       `json:"event"`
+	Seq       uint64       `json:"seq"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      events.Event `json:"data"`
+}
+
+// Service manages webhook subscriptions and delivers bus events to them.
+type Service struct {
+	cfg Config
+
+	mu          sync.RWMutex
+	subs        map[string]Subscription
+	deliveries  map[string][]Delivery
+	deadLetters []DeadLetter
+	// queues hold the events of each subscription for its worker, which delivers
+	// them one after another, in the order they were published.
+	queues  map[string]chan job
+	stopped bool
+	dropped atomic.Uint64
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	unsubscribe func()
+}
+
+func NewService(cfg Config) *Service {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.BaseBackoff {
+		cfg.MaxBackoff = max(time.Minute, cfg.BaseBackoff)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 256
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		cfg:         cfg,
+		subs:        make(map[string]Subscription),
+		deliveries:  make(map[string][]Delivery),
+		queues:      make(map[string]chan job),
+		ctx:         ctx,
+		cancel:      cancel,
+		unsubscribe: func() {},
+	}
+}
+
+// Start delivers the events published on the bus until Stop is called.
+func (s *Service) Start(bus *events.Bus) {
+	s.unsubscribe = bus.SubscribeAsync(s.dispatch, 256)
+}
+
+// Stop stops receiving events, aborts running deliveries and waits for them.
+// Deliveries that did not succeed yet, queued ones included, are dead-lettered.
+func (s *Service) Stop() {
+	s.unsubscribe()
+	s.cancel()
+	s.mu.Lock()
+	s.stopped = true
+	for id, queue := range s.queues {
+		close(queue)
+		delete(s.queues, id)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Dropped returns the number of events dropped because the queue of their
+// subscription was full.
+func (s *Service) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Create adds a subscription, generating its ID and, if empty, its secret.
+func (s *Service) Create(sub Subscription) Subscription {
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = time.Now().UTC()
+	if sub.Secret == "" {
+		sub.Secret = newSecret()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub.ID] = sub
+	return sub
+}
+
+func (s *Service) Get(id string) (Subscription, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.subs[id]
+	return sub, ok
+}
+
+// List returns all subscriptions, oldest first.
+func (s *Service) List() []Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subs := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b Subscription) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return subs
+}
+
+// Update changes a subscription with fn.
+func (s *Service) Update(id string, fn func(*Subscription)) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return Subscription{}, false
+	}
+	fn(&sub)
+	s.subs[id] = sub
+	return sub, true
+}
+
+func (s *Service) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.subs[id]
+	delete(s.subs, id)
+	delete(s.deliveries, id)
+	if queue, ok := s.queues[id]; ok {
+		close(queue)
+		delete(s.queues, id)
+	}
+	return ok
+}
+
+// Deliveries returns the latest delivery attempts of a subscription, oldest first.
+func (s *Service) Deliveries(id string) []Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.deliveries[id])
+}
+
+func (s *Service) DeadLetters() []DeadLetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.deadLetters)
+}
+
+// Sign returns the signature of a delivery: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription secret, prefixed with "sha256=".
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// dispatch queues the event for the worker of every matching subscription,
+// starting the worker with the first event. It never blocks: events for a full
+// queue are dropped and counted.
+func (s *Service) dispatch(env events.Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+
+	for _, sub := range s.subs {
+		if !sub.Active || (len(sub.Events) > 0 && !slices.Contains(sub.Events, env.Event.Name())) {
+			continue
+		}
+		id := uuid.New().String()
+		body, err := json.Marshal(payload{ID: id, Event: env.Event.Name(), Seq: env.Seq, CreatedAt: env.Time, Data: env.Event})
+		if err != nil {
+			continue
+		}
+
+		queue, ok := s.queues[sub.ID]
+		if !ok {
+			queue = make(chan job, s.cfg.QueueSize)
+			s.queues[sub.ID] = queue
+			s.wg.Add(1)
+			go s.work(queue)
+		}
+		select {
+		case queue <- job{sub: sub, id: id, env: env, body: body}:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// work delivers the queued events of a subscription until its queue is closed.
+// Events of a deleted subscription are skipped; after Stop they are dead-lettered.
+func (s *Service) work(queue <-chan job) {
+	defer s.wg.Done()
+	for j := range queue {
+		if s.ctx.Err() != nil {
+			s.deadLetter(j.sub, j.id, j.env, j.body, 0, "shutdown")
+			continue
+		}
+		if _, ok := s.Get(j.sub.ID); !ok {
+			continue
+		}
+		s.deliver(j.sub, j.id, j.env, j.body)
+	}
+}
+
+// deliver POSTs the body until it is accepted, retrying with exponential backoff.
+func (s *Service) deliver(sub Subscription, id string, env events.Envelope, body []byte) {
+	backoff := s.cfg.BaseBackoff
+	lastErr := ""
+	for attempt := 1; attempt <= s.cfg.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-s.ctx.Done():
+				timer.Stop()
+				s.deadLetter(sub, id, env, body, attempt-1, "shutdown: "+lastErr)
+				return
+			}
+			backoff = min(backoff*2, s.cfg.MaxBackoff)
+		}
+
+		d := s.attempt(sub, id, env, body, attempt)
+		s.log(d)
+		if d.Success {
+			return
+		}
+		lastErr = d.Error
+	}
+	s.deadLetter(sub, id, env, body, s.cfg.MaxAttempts, lastErr)
+}
+
+func (s *Service) attempt(sub Subscription, id string, env events.Envelope, body []byte, attempt int) Delivery {
+	d := Delivery{
+		ID:             id,
+		SubscriptionID: sub.ID,
+		Event:          env.Event.Name(),
+		EventSeq:       env.Seq,
+		Attempt:        attempt,
+		Time:           time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	timestamp := strconv.FormatInt(d.Time.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, body))
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	resp.Body.Close()
+
+	d.StatusCode = resp.StatusCode
+	d.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Success {
+		d.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return d
+}
+
+func (s *Service) log(d Delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[d.SubscriptionID]; !ok {
+		return
+	}
+	log := append(s.deliveries[d.SubscriptionID], d)
+	if len(log) > maxDeliveryLog {
+		log = log[len(log)-maxDeliveryLog:]
+	}
+	s.deliveries[d.SubscriptionID] = log
+}
+
+func (s *Service) deadLetter(sub Subscription, id string, env events.Envelope, body []byte, attempts int, lastErr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append(s.deadLetters, DeadLetter{
+		DeliveryID:     id,
+		SubscriptionID: sub.ID,
+		Event:          env.Event.Name(),
+		Payload:        body,
+		Attempts:       attempts,
+		LastError:      lastErr,
+		Time:           time.Now().UTC(),
+	})
+	if len(s.deadLetters) > maxDeadLetters {
+		s.deadLetters = slices.Clone(s.deadLetters[len(s.deadLetters)-maxDeadLetters:])
+	}
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
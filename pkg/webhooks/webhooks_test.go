@@ -0,0 +1,157 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"awesomeProject/pkg/events"
+)
+
+type testEvent struct {
+	Kind string `json:"kind"`
+}
+
+func (e testEvent) Name() string        { return e.Kind }
+func (e testEvent) AggregateID() string { return "order-1" }
+
+func newTestService(t *testing.T, bus *events.Bus) *Service {
+	t.Helper()
+	s := NewService(Config{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+	s.Start(bus)
+	return s
+}
+
+func TestDeliverySignedWithRetries(t *testing.T) {
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var got []map[string]any
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderSignature) != Sign("secret", r.Header.Get(HeaderTimestamp), body) {
+			t.Errorf("invalid signature %q", r.Header.Get(HeaderSignature))
+		}
+		// Fail the first attempt of every delivery.
+		if calls.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p map[string]any
+		_ = json.Unmarshal(body, &p)
+		mu.Lock()
+		got = append(got, p)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	bus := events.NewBus()
+	s := newTestService(t, bus)
+	sub := s.Create(Subscription{URL: receiver.URL, Events: []string{"order.paid"}, Secret: "secret", Active: true})
+
+	bus.Publish(testEvent{"order.created"}, testEvent{"order.paid"})
+	waitFor(t, func() bool { return len(s.Deliveries(sub.ID)) == 2 })
+	s.Stop()
+
+	if len(got) != 1 || got[0]["event"] != "order.paid" || got[0]["data"].(map[string]any)["kind"] != "order.paid" {
+		t.Errorf("unexpected payloads: %v", got)
+	}
+	deliveries := s.Deliveries(sub.ID)
+	if deliveries[0].Success || deliveries[0].StatusCode != http.StatusServiceUnavailable || !deliveries[1].Success {
+		t.Errorf("unexpected delivery log: %+v", deliveries)
+	}
+	if len(s.DeadLetters()) != 0 {
+		t.Errorf("unexpected dead letters: %+v", s.DeadLetters())
+	}
+}
+
+func TestDeadLetterAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	bus := events.NewBus()
+	s := newTestService(t, bus)
+	sub := s.Create(Subscription{URL: receiver.URL, Active: true})
+
+	bus.Publish(testEvent{"order.created"})
+	waitFor(t, func() bool { return len(s.DeadLetters()) == 1 })
+	s.Stop()
+
+	dead := s.DeadLetters()[0]
+	if dead.SubscriptionID != sub.ID || dead.Attempts != 3 || dead.Event != "order.created" {
+		t.Errorf("unexpected dead letter: %+v", dead)
+	}
+	if n := len(s.Deliveries(sub.ID)); n != 3 {
+		t.Errorf("logged %d attempts, want 3", n)
+	}
+}
+
+// Test that the events of a subscription are delivered in order, one at a time,
+// and that events beyond its queue are dropped.
+func TestDeliveryQueue(t *testing.T) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var seqs []float64
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		seqs = append(seqs, p["seq"].(float64))
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+	}))
+	defer receiver.Close()
+
+	bus := events.NewBus()
+	s := NewService(Config{QueueSize: 2})
+	s.Start(bus)
+	sub := s.Create(Subscription{URL: receiver.URL, Active: true})
+
+	bus.Publish(testEvent{"order.created"})
+	<-started
+	// The first event is being delivered: two more fit the queue, the last two are dropped.
+	bus.Publish(testEvent{"order.product_added"}, testEvent{"order.product_added"}, testEvent{"order.paid"}, testEvent{"order.paid"})
+	waitFor(t, func() bool { return s.Dropped() == 2 })
+	close(release)
+	waitFor(t, func() bool { return len(s.Deliveries(sub.ID)) == 3 })
+	s.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seqs) != 3 || seqs[0] != 1 || seqs[1] != 2 || seqs[2] != 3 {
+		t.Errorf("delivered sequence numbers: got %v, want [1 2 3]", seqs)
+	}
+}
+
+func TestDeadLettersCapped(t *testing.T) {
+	s := NewService(Config{})
+	sub := Subscription{ID: "sub-1"}
+	for i := 0; i < maxDeadLetters+10; i++ {
+		s.deadLetter(sub, fmt.Sprint(i), events.Envelope{Event: testEvent{"order.created"}}, nil, 1, "unexpected status 500")
+	}
+
+	dead := s.DeadLetters()
+	if len(dead) != maxDeadLetters || dead[0].DeliveryID != "10" || dead[len(dead)-1].DeliveryID != fmt.Sprint(maxDeadLetters+9) {
+		t.Errorf("kept %d dead letters from %s, want the latest %d", len(dead), dead[0].DeliveryID, maxDeadLetters)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}